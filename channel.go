@@ -0,0 +1,72 @@
+package gadget
+
+import (
+	"reflect"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+/*
+ * A channel in a component's data can be iterated with g-for. A component
+ * is rendered many times, so receiving while rendering would lose values.
+ * In stead, every render receives what's available without blocking and
+ * appends it to what was received before, and the template iterates over
+ * everything received so far:
+ *
+ * type ChatComponent struct {
+ *     gadget.BaseComponent
+ *     Messages chan string // <li g-for="m in Messages" g-value="m"></li>
+ * }
+ *
+ * A buffered channel that holds values renders the component again, but
+ * nothing wakes up the loop when something is sent: send an Action on
+ * Gadget.Update after sending. A sender on an unbuffered channel blocks
+ * until the component is rendered. Replacing the channel starts over.
+ */
+
+// received is what was received from a channel
+type received struct {
+	// the channel, a copy: a field's value follows the field
+	ch     reflect.Value
+	values reflect.Value // a slice of the channel's element type
+}
+
+// pushChannels receives from the channels in context and pushes what was
+// received so far in stead of them
+func (ci *ComponentInstance) pushChannels(context *vtree.Context) {
+	variables := append([]vtree.Variable(nil), context.Variables...)
+	for _, variable := range variables {
+		ch := variable.Value
+		if ch.Kind() != reflect.Chan || ch.Type().ChanDir()&reflect.RecvDir == 0 {
+			continue
+		}
+		if ci.State.received == nil {
+			ci.State.received = make(map[string]*received)
+		}
+		r := ci.State.received[variable.Name]
+		if r == nil || r.ch.Pointer() != ch.Pointer() {
+			r = &received{ch: reflect.New(ch.Type()).Elem(), values: reflect.MakeSlice(reflect.SliceOf(ch.Type().Elem()), 0, 0)}
+			r.ch.Set(ch)
+			ci.State.received[variable.Name] = r
+		}
+		for !ch.IsNil() {
+			value, ok := ch.TryRecv()
+			// nothing to receive, or closed
+			if !ok {
+				break
+			}
+			r.values = reflect.Append(r.values, value)
+		}
+		context.PushValue(variable.Name, r.values)
+	}
+}
+
+// pendingChannels tells if a channel the component received from holds values
+func (ci *ComponentInstance) pendingChannels() bool {
+	for _, r := range ci.State.received {
+		if !r.ch.IsNil() && r.ch.Len() > 0 {
+			return true
+		}
+	}
+	return false
+}
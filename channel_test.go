@@ -0,0 +1,69 @@
+package gadget
+
+import (
+	"testing"
+)
+
+type ChannelComponent struct {
+	GeneratedComponent
+	Messages chan string
+}
+
+func TestChannels(t *testing.T) {
+	SetupTestGadget := func() (*Gadget, *ChannelComponent) {
+		g := NewGadget(NewTestBridge())
+		comp := &ChannelComponent{Messages: make(chan string, 5)}
+		comp.gTemplate = `<ul><li g-for="m in Messages" g-value="m"></li></ul>`
+		comp.SetupStorage(NewStructStorage(comp))
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name:    "channel",
+			Builder: func() Component { return comp },
+		}))
+		return g, comp
+	}
+
+	AssertTree := func(t *testing.T, g *Gadget, expected string) {
+		t.Helper()
+		if r := g.App.State.ExecutedTree.ToString(); r != expected {
+			t.Errorf("Expected %s, got %s", expected, r)
+		}
+	}
+
+	t.Run("Test received values", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		comp.Messages <- "a"
+		comp.Messages <- "b"
+		g.SingleLoop()
+		AssertTree(t, g, "<ul><li>a</li><li>b</li></ul>")
+
+		// rendering again doesn't lose them
+		g.App.Invalidate()
+		g.SingleLoop()
+		AssertTree(t, g, "<ul><li>a</li><li>b</li></ul>")
+	})
+
+	t.Run("Test sent later", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		g.SingleLoop()
+		AssertTree(t, g, "<ul></ul>")
+
+		comp.Messages <- "a"
+		g.SingleLoop()
+		AssertTree(t, g, "<ul><li>a</li></ul>")
+
+		close(comp.Messages)
+		g.SingleLoop()
+		AssertTree(t, g, "<ul><li>a</li></ul>")
+	})
+
+	t.Run("Test replaced", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		comp.Messages <- "a"
+		g.SingleLoop()
+
+		comp.Messages = make(chan string, 1)
+		comp.Messages <- "b"
+		g.SingleLoop()
+		AssertTree(t, g, "<ul><li>b</li></ul>")
+	})
+}
@@ -1,6 +1,7 @@
 package gadget
 
 import (
+	"fmt"
 	"reflect"
 
 	"github.com/go-gadget/gadget/j"
@@ -9,6 +10,15 @@ import (
 
 type Handler func()
 
+// An EventHandler is a Handler that receives the event's payload
+type EventHandler func(*vtree.Event)
+
+// EventHandlerComponent can be implemented by components that have handlers
+// that need the event's payload (e.g. the key pressed or the current value)
+type EventHandlerComponent interface {
+	EventHandlers() map[string]EventHandler
+}
+
 type Component interface {
 	Init(*ComponentState)
 	Props() []string
@@ -18,6 +28,38 @@ type Component interface {
 	Components() map[string]*ComponentFactory
 }
 
+/*
+ * Lifecycle hooks. Components can implement any of these to be notified:
+ *
+ * Created       - once its props are set, before it's rendered the first time
+ * Mounted       - after its tree was added to the bridge (e.g. the DOM)
+ * Updated       - after changes to its tree were applied to the bridge
+ * BeforeUnmount - before its tree is removed, it's still fully functional
+ * Unmounted     - after its tree was removed from the bridge
+ *
+ * Mounted, Updated and Unmounted run after the loop's ChangeSet has been
+ * applied, children before their parents.
+ */
+type CreatedHook interface {
+	Created()
+}
+
+type MountedHook interface {
+	Mounted()
+}
+
+type UpdatedHook interface {
+	Updated()
+}
+
+type BeforeUnmountHook interface {
+	BeforeUnmount()
+}
+
+type UnmountedHook interface {
+	Unmounted()
+}
+
 type ComponentBuilder func() Component
 
 type ComponentFactory struct {
@@ -63,10 +105,11 @@ type UserAction struct {
 	component *ComponentInstance
 	node      vtree.Node
 	handler   string
+	event     *vtree.Event
 }
 
 func (a *UserAction) Run() {
-	a.component.HandleEvent(a.handler)
+	a.component.HandleEvent(a.handler, a.event)
 }
 
 type ComponentState struct {
@@ -74,33 +117,137 @@ type ComponentState struct {
 	UnexecutedTree *vtree.Element
 	ExecutedTree   *vtree.Element
 	Mounts         []*Mount
+	// The component this component is mounted in, and the element it's
+	// mounted on (as last rendered by the parent)
+	Parent  *ComponentInstance
+	Point   *vtree.Element
+	created bool
+	events  vtree.EventDispatcher
+	// render in the next loop, even if the storage didn't change
+	invalid bool
+	// the keys of the storage that changed since the last render, see changed
+	changes []string
+	// cached computed properties, by name
+	computed map[string]*computedValue
+	watchers []*watcher
+	// what was received from channels in the data, by name
+	received map[string]*received
+	// the component this is the state of
+	instance *ComponentInstance
+}
+
+/*
+ * Emit sends a custom event to the parent component, which listens for it
+ * on the component's element, e.g.
+ *
+ * <child-comp g-on:saved="onSaved"></child-comp>
+ *
+ * The parent's handler is invoked through the Action queue, an EventHandler
+ * receives the payload in Event.Payload. Modifiers like .once apply.
+ */
+func (s *ComponentState) Emit(name string, payload interface{}) {
+	if s.Point == nil {
+		j.J("Can't emit " + name + ", component isn't mounted")
+		return
+	}
+	s.events.Dispatch(s.Point, &vtree.Event{Type: name, Payload: payload}, nil)
 }
 
 type ComponentInstance struct {
-	Comp      Component
-	State     *ComponentState
-	InnerTree vtree.NodeList // might become a map
+	Name  string // the name of the factory it was built by
+	Comp  Component
+	State *ComponentState
+	Slots vtree.Slots // content passed by the caller
+	// slots filled with content from a caller during the current Execute,
+	// the caller binds its handlers
+	filled map[*vtree.Element]bool
+	// a template error is reported once the component is mounted, so the
+	// error handlers of its parents get it
+	templateErr error
+	ids         *vtree.IDSource // the Gadget's, nil for El's
 }
 
 func (ci *ComponentInstance) Init() {
+	ci.State.instance = ci
 	ci.Comp.Init(ci.State)
-	ci.State.UnexecutedTree = vtree.Parse(ci.Comp.Template())
+	tree, err := vtree.ParseTemplateOptions(ci.Name, ci.Comp.Template(), vtree.ParseOptions{IDs: ci.ids})
+	if err != nil {
+		// Render nothing in stead of panicking, the error tells what's wrong
+		ci.templateErr = err
+		tree = ci.ids.Fragment()
+	}
+
+	// A g-if or g-for on the root may render to no or several elements,
+	// so render it as a fragment (Parse already did if there are several roots)
+	for _, attr := range []string{"g-if", "g-for"} {
+		if _, ok := tree.Attributes[attr]; ok && !tree.IsFragment() {
+			tree = ci.ids.Fragment(tree)
+		}
+	}
+	ci.State.UnexecutedTree = tree
 }
 
 func (ci *ComponentInstance) RawSetValue(key string, val interface{}) {
 	ci.Comp.Data().RawSetValue(key, val)
 }
 
-func (ci *ComponentInstance) SetValue(key string, val interface{}) {
-	ci.RawSetValue(key, val)
+// GetValue gets the value of key, which may be a path like Address.City
+func (ci *ComponentInstance) GetValue(key string) (interface{}, error) {
+	return ci.Comp.Data().GetValue(key)
+}
+
+// SetValue sets key, converting val to its type where possible
+func (ci *ComponentInstance) SetValue(key string, val interface{}) error {
+	return ci.Comp.Data().SetValue(key, val)
+}
+
+// Invalidate renders the component in the next loop, for changes its
+// storage can't see
+func (ci *ComponentInstance) Invalidate() {
+	ci.State.invalid = true
+}
+
+// changed tells if the component must be rendered again
+func (ci *ComponentInstance) changed() bool {
+	ci.State.changes = nil
+	// There's nothing to compare with before the first render. The
+	// watchers need the changes of an invalid component
+	if ci.State.ExecutedTree == nil || ci.State.invalid && len(ci.State.watchers) == 0 {
+		return true
+	}
+	// Changes fingerprints the data, it's asked once per loop
+	ts, ok := ci.Comp.Data().(TrackingStorage)
+	if !ok {
+		return true
+	}
+	ci.State.changes = ts.Changes()
+	return ci.State.invalid || len(ci.State.changes) > 0 || ci.pendingChannels()
+}
+
+// setProps stores the props in the component. Unchanged props aren't
+// written, that would make the component render again
+func (ci *ComponentInstance) setProps(props []*vtree.Variable) {
+	data := ci.Comp.Data()
+	for _, variable := range props {
+		value := variable.Value.Interface()
+		if current, err := data.GetValue(variable.Name); err == nil && reflect.DeepEqual(current, value) {
+			continue
+		}
+		if err := data.SetValue(variable.Name, value); err != nil {
+			ci.reportError(&PropError{Component: ci.Name, Prop: variable.Name, Err: err})
+		}
+	}
 }
 
 func (ci *ComponentInstance) bindSpecials(node *vtree.Element) {
+	if ci.filled[node] {
+		return
+	}
 	// recusively do stuff
 	for k, v := range node.Attributes {
-		if k == "g-click" {
+		if _, ok := vtree.ParseEventAttribute(k); ok {
 			vv := v
-			f := func() {
+			f := func(ev *vtree.Event) {
 				// One of the few actions that actually does stuff
 				// But this should be reversed: A click on a control
 				// creates an action (task). When handled, look up
@@ -109,19 +256,25 @@ func (ci *ComponentInstance) bindSpecials(node *vtree.Element) {
 					component: ci,
 					node:      node,
 					handler:   vv,
+					event:     ev,
 				}
 			}
-			node.Handlers[v] = f
+			node.Handlers[k] = f
 		}
-		if k == "g-bind" {
-			j.J("bindSpecials", k, v)
-			vv := v
-			f := func(value string) {
-				// should probably do type conversions, return something if fails
-				// RawSetValue doesn't trigger a new Action
-				ci.RawSetValue(vv, value)
+		if modifiers, ok := vtree.ParseModelAttribute(k); ok {
+			key := v
+			// The control pushes its state when it changes (input or
+			// change event). Syncing through an action makes sure anything
+			// depending on the value gets rendered again
+			node.Handlers[k] = func(ev *vtree.Event) {
+				GetGadget(ci.State.Registry).Update <- &SyncAction{
+					component: ci,
+					node:      node,
+					key:       key,
+					modifiers: modifiers,
+					state:     ev.ControlState(),
+				}
 			}
-			node.Setter = f
 		}
 	}
 
@@ -139,18 +292,37 @@ func (ci *ComponentInstance) Execute(handler vtree.ComponentRenderer, props []*v
 	data := ci.Comp.Data()
 	renderer := vtree.NewRenderer()
 	renderer.Handler = handler
-	renderer.InnerTree = ci.InnerTree
+	renderer.Slots = ci.Slots
+	renderer.ErrorHandler = ci.reportError
+	ci.filled = make(map[*vtree.Element]bool)
+	renderer.SlotHandler = func(slot *vtree.Element, content *vtree.SlotContent) {
+		// Events in slot content are handled by the caller
+		ci.filled[slot] = true
+		if owner, ok := content.Owner.(*ComponentInstance); ok {
+			for _, c := range slot.Children {
+				if el, ok := c.(*vtree.Element); ok {
+					owner.bindSpecials(el)
+				}
+			}
+		}
+	}
 
-	for _, variable := range props {
-		// context.PushValue(variable.Name, variable.Value)
-		ci.RawSetValue(variable.Name, variable.Value.Interface())
+	ci.setProps(props)
+
+	if !ci.State.created {
+		ci.State.created = true
+		if h, ok := ci.Comp.(CreatedHook); ok {
+			h.Created()
+		}
 	}
 
 	// This makes the props available in acontext, for template rendering.
 	// But not on the component itself
 	context := data.MakeContext()
-	// What to do if multi-element (g-for), or nil (g-if)? XXX
-	// always wrap component in <div> ?
+	ci.pushComputed(context)
+	ci.pushChannels(context)
+	// A root that may render to anything but a single element is a
+	// fragment (see Init), which always renders to itself
 	tree := renderer.Render(ci.State.UnexecutedTree, context)[0]
 
 	// we need to add a way for the "bridge" to call actions
@@ -164,6 +336,47 @@ func (ci *ComponentInstance) Execute(handler vtree.ComponentRenderer, props []*v
 	return tree
 }
 
+/*
+ * resolveComponent finds the factory for a component element, by its type
+ * in the component's Components() or the component registry.
+ *
+ * <component :is="expr"> mounts whatever expr evaluates to, either a
+ * *ComponentFactory or the name of a component. <component is="name"> works
+ * too. If it's nil or empty, nothing is mounted
+ */
+func (ci *ComponentInstance) resolveComponent(componentElement *vtree.Element) *ComponentFactory {
+	name := componentElement.Type
+
+	if name == "component" {
+		name = componentElement.Attributes["is"]
+		if is, ok := componentElement.BoundValues["is"]; ok {
+			if !is.IsValid() || !is.CanInterface() {
+				return nil
+			}
+			switch v := is.Interface().(type) {
+			case *ComponentFactory:
+				return v
+			case string:
+				name = v
+			default:
+				ci.reportError(fmt.Errorf("<component :is>: can't mount a %T", v))
+				return nil
+			}
+		}
+		if name == "" {
+			return nil
+		}
+	}
+
+	if builder := ci.Comp.Components()[name]; builder != nil {
+		return builder
+	}
+	if cReg := GetComponentRegistry(ci.State.Registry); cReg != nil {
+		return cReg.Get(name)
+	}
+	return nil
+}
+
 // Mount a comonent somewhere within this component, and store it.
 func (ci *ComponentInstance) Mount(c *ComponentInstance, point *vtree.Element) *Mount {
 	// probably needs lock
@@ -171,70 +384,85 @@ func (ci *ComponentInstance) Mount(c *ComponentInstance, point *vtree.Element) *
 	// store node where mounted (or nil)
 	mount := &Mount{Component: c, Point: point, ToBeRemoved: false}
 	ci.State.Mounts = append(ci.State.Mounts, mount)
-	// c.Mounted() hook?
+	c.State.Parent = ci
+	c.State.Point = point
 	return mount
 }
 
-// ExtractProps checks which props a component accepts and fetches these from the elements attributes
-func (ci *ComponentInstance) ExtractProps(componentElement *vtree.Element) []*vtree.Variable {
-	var props []*vtree.Variable
-
-	for _, propName := range ci.Comp.Props() {
-		if val, ok := componentElement.Attributes[propName]; ok {
-			props = append(props, &vtree.Variable{Name: propName, Value: reflect.ValueOf(val)})
-		} else if val, ok := GetRouterState(ci.State.Registry).CurrentRoute.Params[propName]; ok {
-			props = append(props, &vtree.Variable{Name: propName, Value: reflect.ValueOf(val)})
-		}
+// unmount runs the BeforeUnmount hooks of the component and the components
+// mounted in it, and schedules their Unmounted hooks
+func (ci *ComponentInstance) unmount(g *Gadget) {
+	if h, ok := ci.Comp.(BeforeUnmountHook); ok {
+		h.BeforeUnmount()
+	}
+	for _, m := range ci.State.Mounts {
+		m.Component.unmount(g)
+	}
+	if h, ok := ci.Comp.(UnmountedHook); ok {
+		g.AfterApply(h.Unmounted)
 	}
-
-	return props
 }
 
 func (ci *ComponentInstance) BuildDiff(props []*vtree.Variable, rt *RouteTraverser) (res vtree.ChangeSet) {
+	if ci.templateErr != nil {
+		ci.reportError(ci.templateErr)
+		ci.templateErr = nil
+	}
+
 	// collect changesets
 	var cs []vtree.ChangeSet
 
 	// Invoked when something component-like is encountered. Includes <router-view>
-	ComponentHandler := func(componentElement *vtree.Element, innerElements vtree.NodeList) {
-		// store, if anythingo
-		// actually, not gonna work: <c>hello</c> -> <div><x></x><slot></slot></div>
-		// <x> component wil already clear inner for slot
-		var builder *ComponentFactory
-
-		// Is this really about traversal? Or more about pre-call/render/?
-		if t, ok := ci.Comp.(Traversable); ok {
-			t.BeforeTraverse()
+	ComponentHandler := func(componentElement *vtree.Element, slots vtree.Slots) {
+		for _, content := range slots {
+			content.Owner = ci
 		}
+		builder := ci.resolveComponent(componentElement)
 
-		// First check if the component is already mounted. If so, it can be a router-view
-		// that changes component, an existing component with different props
+		// First check if the component is already mounted. If so, it can be
+		// an existing component with different props
 		for _, m := range ci.State.Mounts {
-			if m.HasComponent(componentElement) {
-				Props := m.Component.ExtractProps(componentElement)
-				changes := m.Component.BuildDiff(Props, rt)
-				cs = append(cs, changes)
-				return
+			if m.ToBeRemoved || !m.HasComponent(componentElement) {
+				continue
 			}
-		}
-
-		// At this point, it was not an already mounted component
-		childcomps := ci.Comp.Components()
-
-		if builder = childcomps[componentElement.Type]; builder == nil {
-			if cReg := GetComponentRegistry(ci.State.Registry); cReg != nil {
-				builder = cReg.Get(componentElement.Type)
+			// e.g. a <component :is> that switched to a different component
+			if m.replacedBy(componentElement, builder) {
+				m.ToBeRemoved = true
+				continue
+			}
+			m.rendered = true
+			// Keep the latest rendering of the element, it carries
+			// the handlers for events the component emits
+			m.Point = componentElement
+			m.Component.State.Point = componentElement
+			m.Component.Slots = slots
+			// the content of its slots is rendered again, it may have changed
+			if len(slots) > 0 {
+				m.Component.Invalidate()
 			}
+			Props, err := m.Component.ExtractProps(componentElement)
+			if err != nil {
+				m.Component.reportError(err)
+			}
+			changes := m.Component.BuildDiff(Props, rt)
+			cs = append(cs, changes)
+			return
 		}
 
 		if builder != nil {
 			// builder is a ComponentComponentFactory, resulting in a Component, not a ComponentInstance
 			cf := GetGadget(ci.State.Registry).NewComponent(builder)
-			cf.InnerTree = innerElements
+			cf.Slots = slots
 			m := ci.Mount(cf, componentElement)
 
 			m.Name = builder.Name
+			m.Factory = builder
+			m.rendered = true
 
-			Props := m.Component.ExtractProps(componentElement)
+			Props, err := m.Component.ExtractProps(componentElement)
+			if err != nil {
+				m.Component.reportError(err)
+			}
 			changes := m.Component.BuildDiff(Props, rt)
 			for _, ch := range changes {
 				if ach, ok := ch.(*vtree.AddChange); ok && ach.Parent == nil {
@@ -242,39 +470,81 @@ func (ci *ComponentInstance) BuildDiff(props []*vtree.Variable, rt *RouteTravers
 				}
 			}
 			cs = append(cs, changes)
-		} else {
-			j.J("Could not find / match component "+componentElement.Type, builder, builder == nil, builder != nil)
+		} else if componentElement.Type != "component" {
+			// an empty <component :is> simply mounts nothing
+			j.J("Could not find / match component " + componentElement.Type)
 		}
 	}
 
+	// Is this really about traversal? Or more about pre-call/render/?
+	// It must run before rendering, since it may change what gets rendered
+	if t, ok := ci.Comp.(Traversable); ok {
+		t.BeforeTraverse()
+	}
+
+	// If nothing changed, the ExecutedTree is still valid. The components
+	// mounted in it may have changed though
+	ci.setProps(props)
+	changed := ci.changed()
+	ci.queueWatchers(GetGadget(ci.State.Registry))
+	if !changed {
+		// Content passed to slots is rendered by the component it's passed
+		// to, through the handler of the loop it was passed in. Bind the
+		// current one, or changes of components in the content get lost
+		for _, m := range ci.State.Mounts {
+			for _, content := range m.Component.Slots {
+				if content.Owner == ci && content.Renderer != nil {
+					content.Renderer.Handler = ComponentHandler
+				}
+			}
+		}
+		for _, m := range ci.State.Mounts {
+			Props, err := m.Component.ExtractProps(m.Point)
+			if err != nil {
+				m.Component.reportError(err)
+			}
+			cs = append(cs, m.Component.BuildDiff(Props, rt))
+		}
+		for i := len(cs) - 1; i >= 0; i-- {
+			res = append(res, cs[i]...)
+		}
+		return res
+	}
+
+	// Mounts whose element isn't rendered anymore are removed below. Not
+	// only those whose element was deleted, an element above it may be
+	// gone. Content passed to slots is rendered during Execute as well
+	for _, m := range ci.State.Mounts {
+		m.rendered = false
+	}
 	// recusively calls BuildDiff through ComponentHandler
 	tree := ci.Execute(ComponentHandler, props)
+	if ts, ok := ci.Comp.Data().(TrackingStorage); ok {
+		ts.Commit()
+	}
+	ci.State.invalid = false
 
 	var changes vtree.ChangeSet
+	g := GetGadget(ci.State.Registry)
 
 	if ci.State.ExecutedTree == nil {
 		changes = vtree.ChangeSet{&vtree.AddChange{Parent: nil, Node: tree}}
+		if h, ok := ci.Comp.(MountedHook); ok {
+			g.AfterApply(h.Mounted)
+		}
 	} else {
 		changes = vtree.Diff(ci.State.ExecutedTree, tree)
-		for _, ch := range changes {
-			if dch, ok := ch.(*vtree.DeleteChange); ok {
-				if el, ok := dch.Node.(*vtree.Element); ok && el.IsComponent() {
-					for _, m := range ci.State.Mounts {
-						if m.HasComponent(el) {
-							m.ToBeRemoved = true
-						}
-					}
-				}
-			}
+		if h, ok := ci.Comp.(UpdatedHook); ok && len(changes) > 0 {
+			g.AfterApply(h.Updated)
 		}
 	}
 	cs = append(cs, changes)
 	var FilteredMounts []*Mount
 	for _, m := range ci.State.Mounts {
-		if m.ToBeRemoved {
+		if m.ToBeRemoved || !m.rendered {
+			m.Component.unmount(g)
 			cs = append(cs, vtree.ChangeSet{&vtree.DeleteChange{Node: m.Component.State.ExecutedTree}})
 			continue
-			// call some hook?
 		}
 		FilteredMounts = append(FilteredMounts, m)
 	}
@@ -288,8 +558,23 @@ func (ci *ComponentInstance) BuildDiff(props []*vtree.Variable, rt *RouteTravers
 	return res
 }
 
-func (ci *ComponentInstance) HandleEvent(event string) {
-	ci.Comp.Handlers()[event]()
+// HandleEvent invokes the handler by name. Handlers that want the event's
+// payload (EventHandlers) take precedence over regular Handlers
+func (ci *ComponentInstance) HandleEvent(name string, event *vtree.Event) {
+	if ec, ok := ci.Comp.(EventHandlerComponent); ok {
+		if handler, ok := ec.EventHandlers()[name]; ok {
+			if event == nil {
+				event = &vtree.Event{}
+			}
+			handler(event)
+			return
+		}
+	}
+	if handler, ok := ci.Comp.Handlers()[name]; ok {
+		handler()
+		return
+	}
+	j.J("No handler found for " + name)
 }
 
 type ComponentRegistry struct {
@@ -1,7 +1,11 @@
 package gadget
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/go-gadget/gadget/vtree"
 )
 
 func TestComponentSlots(t *testing.T) {
@@ -82,6 +86,85 @@ func TestComponentSlots(t *testing.T) {
 			t.Errorf("Did not get expected rendered tree, got %s", rendered)
 		}
 	})
+	t.Run("Test named slots", func(t *testing.T) {
+		g := NewGadget(NewTestBridge())
+		ChildComponentFactory := MakeDummyFactory(
+			`<div><slot name="header">no header</slot><slot></slot><slot name="footer">no footer</slot></div>`,
+			nil,
+			nil,
+		)
+		component := g.NewComponent(MakeDummyFactory(
+			`<div><test-child><template g-slot="header"><h1 g-value="StringVal"></h1></template>`+
+				`<p>one</p><p>two</p></test-child></div>`,
+			map[string]*ComponentFactory{"test-child": ChildComponentFactory},
+			nil,
+		))
+		g.Mount(component)
+		component.SetValue("StringVal", "Title")
+		g.SingleLoop()
+
+		rendered := FlattenComponents(g.App).ToString()
+
+		if rendered != `<div><test-child><div><slot name="header"><h1>Title</h1></slot><slot><p>one</p><p>two</p></slot>`+
+			`<slot name="footer">no footer</slot></div></test-child></div>` {
+			t.Errorf("Did not get expected rendered tree, got %s", rendered)
+		}
+	})
+	t.Run("Test scoped slot", func(t *testing.T) {
+		g := NewGadget(NewTestBridge())
+		todoList := &ComponentFactory{
+			Name: "todo-list",
+			Builder: func() Component {
+				list := &TodoListComponent{}
+				list.gTemplate = `<ul><li g-for="todo in Todos"><slot name="row" :todo="todo"><span g-value="todo.Title"></span></slot></li></ul>`
+				list.gProps = []string{"Todos"}
+				list.SetupStorage(NewStructStorage(list))
+				return list
+			},
+		}
+		parent := &TodoListComponent{Todos: []Todo{{1, "write", false}, {2, "test", true}}}
+		parent.gTemplate = `<div><todo-list :Todos="Todos"><template g-slot:row="props">` +
+			`<b g-value="props.todo.Title"></b></template></todo-list></div>`
+		parent.gComponents = map[string]*ComponentFactory{"todo-list": todoList}
+		parent.SetupStorage(NewStructStorage(parent))
+
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name:    "parent",
+			Builder: func() Component { return parent },
+		}))
+		g.SingleLoop()
+
+		rendered := FlattenComponents(g.App).ToString()
+
+		if rendered != `<div><todo-list><ul><li><slot name="row"><b>write</b></slot></li>`+
+			`<li><slot name="row"><b>test</b></slot></li></ul></todo-list></div>` {
+			t.Errorf("Did not get expected rendered tree, got %s", rendered)
+		}
+	})
+	t.Run("Test events in slot content are handled by the caller", func(t *testing.T) {
+		g := NewGadget(NewTestBridge())
+		var comp *EventComponent
+		child := MakeDummyFactory("<div><slot></slot></div>", nil, nil)
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name: "EventComponent",
+			Builder: func() Component {
+				comp = &EventComponent{}
+				comp.gTemplate = `<div><test-child><button g-click="plain"></button></test-child></div>`
+				comp.gComponents = map[string]*ComponentFactory{"test-child": child}
+				comp.SetupStorage(NewStructStorage(comp))
+				return comp
+			},
+		}))
+		g.SingleLoop()
+
+		childTree := g.App.State.Mounts[0].Component.State.ExecutedTree
+		button := childTree.Children[0].(*vtree.Element).Children[0].(*vtree.Element)
+		TriggerEvent(t, g, button, &vtree.Event{Type: "click"})
+
+		if r := strings.Join(comp.Events, ","); r != "plain" {
+			t.Errorf("Expected the caller to handle the click, got %q", r)
+		}
+	})
 	/*
 
 			Does not work - nested components are too complex. For example, under which component would
@@ -124,3 +207,473 @@ func TestComponentSlots(t *testing.T) {
 		})
 	*/
 }
+
+type EventComponent struct {
+	DummyComponent
+	Events []string
+}
+
+func (e *EventComponent) EventHandlers() map[string]EventHandler {
+	return map[string]EventHandler{
+		"record": func(ev *vtree.Event) {
+			e.Events = append(e.Events, ev.Type+":"+ev.Key+":"+ev.Value)
+		},
+	}
+}
+
+func (e *EventComponent) Handlers() map[string]Handler {
+	return map[string]Handler{
+		"plain": func() {
+			e.Events = append(e.Events, "plain")
+		},
+	}
+}
+
+// TriggerEvent triggers event on el through the TestBridge and runs the
+// resulting actions, if any. Actions may queue new actions (e.g. Emit), so
+// the Update channel must be buffered for those
+func TriggerEvent(t *testing.T, g *Gadget, el *vtree.Element, event *vtree.Event) []vtree.EventDispatch {
+	t.Helper()
+
+	done := make(chan []vtree.EventDispatch)
+	go func() {
+		done <- g.Bridge.(*TestBridge).TriggerEvent(el, event)
+	}()
+	for {
+		select {
+		case action := <-g.Update:
+			action.Run()
+		case dispatches := <-done:
+			for {
+				select {
+				case action := <-g.Update:
+					action.Run()
+				default:
+					return dispatches
+				}
+			}
+		}
+	}
+}
+
+func TestComponentEvents(t *testing.T) {
+	SetupTestGadget := func() (*Gadget, *EventComponent) {
+		g := NewGadget(NewTestBridge())
+		var comp *EventComponent
+		component := g.NewComponent(&ComponentFactory{
+			Name: "EventComponent",
+			Builder: func() Component {
+				comp = &EventComponent{}
+				comp.gTemplate = `<div><input g-on:keydown="record" @input="record"/><button g-click="plain" @mouseover="plain"></button>` +
+					`<form @submit.prevent="plain"><input @keydown.enter.once="record"/></form></div>`
+				comp.SetupStorage(NewStructStorage(comp))
+				return comp
+			},
+		})
+		g.Mount(component)
+		g.SingleLoop()
+		return g, comp
+	}
+
+	t.Run("Test handlers bound per event", func(t *testing.T) {
+		g, _ := SetupTestGadget()
+		input := g.App.State.ExecutedTree.Children[0].(*vtree.Element)
+		button := g.App.State.ExecutedTree.Children[1].(*vtree.Element)
+
+		for _, attr := range []string{"g-on:keydown", "g-on:input"} {
+			if _, ok := input.Handlers[attr]; !ok {
+				t.Errorf("Expected handler for %s on input", attr)
+			}
+		}
+		for _, attr := range []string{"g-click", "g-on:mouseover"} {
+			if _, ok := button.Handlers[attr]; !ok {
+				t.Errorf("Expected handler for %s on button", attr)
+			}
+		}
+	})
+
+	t.Run("Test payload passed to EventHandler", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		input := g.App.State.ExecutedTree.Children[0].(*vtree.Element)
+
+		TriggerEvent(t, g, input, &vtree.Event{Type: "keydown", Key: "Enter"})
+		TriggerEvent(t, g, input, &vtree.Event{Type: "input", Value: "hello"})
+
+		if r := strings.Join(comp.Events, ","); r != "keydown:Enter:,input::hello" {
+			t.Errorf("Didn't get expected events, got %s", r)
+		}
+	})
+
+	t.Run("Test plain Handler", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		button := g.App.State.ExecutedTree.Children[1].(*vtree.Element)
+
+		TriggerEvent(t, g, button, &vtree.Event{Type: "click"})
+		TriggerEvent(t, g, button, &vtree.Event{Type: "mouseover"})
+
+		if r := strings.Join(comp.Events, ","); r != "plain,plain" {
+			t.Errorf("Didn't get expected events, got %s", r)
+		}
+	})
+
+	t.Run("Test modifiers applied", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		form := g.App.State.ExecutedTree.Children[2].(*vtree.Element)
+
+		dispatches := TriggerEvent(t, g, form, &vtree.Event{Type: "submit"})
+
+		if len(dispatches) != 1 || !dispatches[0].PreventDefault {
+			t.Errorf("Expected preventDefault to be applied, got %+v", dispatches)
+		}
+		if r := strings.Join(comp.Events, ","); r != "plain" {
+			t.Errorf("Didn't get expected events, got %s", r)
+		}
+	})
+
+	t.Run("Test key filter and once", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		input := g.App.State.ExecutedTree.Children[2].(*vtree.Element).Children[0].(*vtree.Element)
+
+		TriggerEvent(t, g, input, &vtree.Event{Type: "keydown", Key: "a"})
+		TriggerEvent(t, g, input, &vtree.Event{Type: "keydown", Key: "Enter", Value: "x"})
+		g.SingleLoop()
+		input = g.App.State.ExecutedTree.Children[2].(*vtree.Element).Children[0].(*vtree.Element)
+		TriggerEvent(t, g, input, &vtree.Event{Type: "keydown", Key: "Enter", Value: "y"})
+
+		if r := strings.Join(comp.Events, ","); r != "keydown:Enter:x" {
+			t.Errorf("Didn't get expected events, got %s", r)
+		}
+	})
+
+	t.Run("Test unknown handler", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		g.App.HandleEvent("doesnotexist", nil)
+
+		if len(comp.Events) != 0 {
+			t.Errorf("Didn't expect any events, got %v", comp.Events)
+		}
+	})
+}
+
+type LifecycleComponent struct {
+	GeneratedComponent
+	Show   bool
+	Text   string
+	Name   string
+	Log    *[]string
+	Bridge *TestBridge
+}
+
+func (l *LifecycleComponent) log(hook string) {
+	*l.Log = append(*l.Log, l.Name+":"+hook)
+}
+
+func (l *LifecycleComponent) Created()       { l.log("created") }
+func (l *LifecycleComponent) Updated()       { l.log("updated") }
+func (l *LifecycleComponent) BeforeUnmount() { l.log("beforeunmount") }
+func (l *LifecycleComponent) Unmounted()     { l.log("unmounted") }
+
+func (l *LifecycleComponent) Mounted() {
+	// the tree must have been added by now
+	if l.Bridge.AddCount == 0 {
+		l.log("mounted-too-early")
+		return
+	}
+	l.log("mounted")
+}
+
+func TestComponentLifecycle(t *testing.T) {
+	SetupTestGadget := func(Template string) (*Gadget, *LifecycleComponent, *[]string) {
+		var log []string
+		bridge := NewTestBridge()
+		g := NewGadget(bridge)
+
+		MakeFactory := func(Name string, Template string, Components map[string]*ComponentFactory) *ComponentFactory {
+			return &ComponentFactory{
+				Name: Name,
+				Builder: func() Component {
+					comp := &LifecycleComponent{Name: Name, Log: &log, Bridge: bridge}
+					comp.gTemplate = Template
+					comp.gComponents = Components
+					comp.SetupStorage(NewStructStorage(comp))
+					return comp
+				},
+			}
+		}
+		grandchild := MakeFactory("grandchild", "<span>Hi</span>", nil)
+		child := MakeFactory("child", `<div><p g-value="Text"></p><x-grandchild></x-grandchild></div>`,
+			map[string]*ComponentFactory{"x-grandchild": grandchild})
+		parent := MakeFactory("parent", Template,
+			map[string]*ComponentFactory{"x-child": child})
+
+		component := g.NewComponent(parent)
+		component.SetValue("Show", true)
+		g.Mount(component)
+		return g, component.Comp.(*LifecycleComponent), &log
+	}
+
+	AssertLog := func(t *testing.T, log *[]string, expected string) {
+		t.Helper()
+		if r := strings.Join(*log, ","); r != expected {
+			t.Errorf("Didn't get expected hooks, got %s", r)
+		}
+		*log = nil
+	}
+
+	t.Run("Test created and mounted", func(t *testing.T) {
+		g, _, log := SetupTestGadget(`<div><x-child g-if="Show"></x-child></div>`)
+		g.SingleLoop()
+
+		AssertLog(t, log, "parent:created,child:created,grandchild:created,grandchild:mounted,child:mounted,parent:mounted")
+	})
+
+	t.Run("Test updated only when changed", func(t *testing.T) {
+		g, _, log := SetupTestGadget(`<div><x-child g-if="Show"></x-child></div>`)
+		g.SingleLoop()
+		*log = nil
+
+		g.SingleLoop()
+		AssertLog(t, log, "")
+
+		g.App.State.Mounts[0].Component.SetValue("Text", "changed")
+		g.SingleLoop()
+		AssertLog(t, log, "child:updated")
+	})
+
+	t.Run("Test unmounted", func(t *testing.T) {
+		g, parent, log := SetupTestGadget(`<div><x-child g-if="Show"></x-child></div>`)
+		g.SingleLoop()
+		*log = nil
+
+		parent.Show = false
+		g.SingleLoop()
+		AssertLog(t, log, "child:beforeunmount,grandchild:beforeunmount,parent:updated,grandchild:unmounted,child:unmounted")
+	})
+
+	t.Run("Test ancestor removed", func(t *testing.T) {
+		g, parent, log := SetupTestGadget(`<div><section g-if="Show"><x-child></x-child></section></div>`)
+		g.SingleLoop()
+		*log = nil
+
+		parent.Show = false
+		g.SingleLoop()
+		AssertLog(t, log, "child:beforeunmount,grandchild:beforeunmount,parent:updated,grandchild:unmounted,child:unmounted")
+		if len(g.App.State.Mounts) != 0 {
+			t.Errorf("Expected the child to be removed, got %d mounts", len(g.App.State.Mounts))
+		}
+
+		bridge := g.Bridge.(*TestBridge)
+		bridge.Reset()
+		parent.Show = true
+		g.SingleLoop()
+		AssertLog(t, log, "child:created,grandchild:created,grandchild:mounted,child:mounted,parent:updated")
+		// the section, and the content of both components
+		if bridge.AddCount != 3 {
+			t.Errorf("Expected the child's content to be added again, got %d adds", bridge.AddCount)
+		}
+	})
+}
+
+type EmitComponent struct {
+	GeneratedComponent
+	Events []string
+}
+
+func (e *EmitComponent) Handlers() map[string]Handler {
+	return map[string]Handler{
+		"save": func() {
+			e.State.Emit("saved", 42)
+		},
+		"plain": func() {
+			e.Events = append(e.Events, "plain")
+		},
+	}
+}
+
+func (e *EmitComponent) EventHandlers() map[string]EventHandler {
+	return map[string]EventHandler{
+		"onSaved": func(ev *vtree.Event) {
+			e.Events = append(e.Events, fmt.Sprintf("%s:%v", ev.Type, ev.Payload))
+		},
+	}
+}
+
+func TestComponentEmit(t *testing.T) {
+	SetupTestGadget := func(ParentTemplate string) (*Gadget, *EmitComponent, *EmitComponent) {
+		g := NewGadget(NewTestBridge())
+		// Emit queues actions while actions are being handled
+		g.Update = make(chan Action, 10)
+
+		var child *EmitComponent
+		childFactory := &ComponentFactory{
+			Name: "child",
+			Builder: func() Component {
+				child = &EmitComponent{}
+				child.gTemplate = `<button g-click="save"></button>`
+				child.SetupStorage(NewStructStorage(child))
+				return child
+			},
+		}
+		parent := &EmitComponent{}
+		parent.gTemplate = ParentTemplate
+		parent.gComponents = map[string]*ComponentFactory{"child-comp": childFactory}
+		parent.SetupStorage(NewStructStorage(parent))
+
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name:    "parent",
+			Builder: func() Component { return parent },
+		}))
+		g.SingleLoop()
+		return g, parent, child
+	}
+	Click := func(t *testing.T, g *Gadget) {
+		t.Helper()
+		button := g.App.State.Mounts[0].Component.State.ExecutedTree
+		TriggerEvent(t, g, button, &vtree.Event{Type: "click"})
+	}
+
+	t.Run("Test payload routed to parent", func(t *testing.T) {
+		g, parent, child := SetupTestGadget(`<div><child-comp g-on:saved="onSaved"></child-comp></div>`)
+		Click(t, g)
+
+		if r := strings.Join(parent.Events, ","); r != "saved:42" {
+			t.Errorf("Didn't get expected events on parent, got %s", r)
+		}
+		if len(child.Events) != 0 {
+			t.Errorf("Didn't expect events on child, got %v", child.Events)
+		}
+	})
+
+	t.Run("Test shorthand and plain handler", func(t *testing.T) {
+		g, parent, _ := SetupTestGadget(`<div><child-comp @saved="plain"></child-comp></div>`)
+		Click(t, g)
+
+		if r := strings.Join(parent.Events, ","); r != "plain" {
+			t.Errorf("Didn't get expected events on parent, got %s", r)
+		}
+	})
+
+	t.Run("Test once", func(t *testing.T) {
+		g, parent, _ := SetupTestGadget(`<div><child-comp g-on:saved.once="onSaved"></child-comp></div>`)
+		Click(t, g)
+		g.SingleLoop()
+		Click(t, g)
+
+		if r := strings.Join(parent.Events, ","); r != "saved:42" {
+			t.Errorf("Didn't get expected events on parent, got %s", r)
+		}
+	})
+
+	t.Run("Test not listening", func(t *testing.T) {
+		g, parent, _ := SetupTestGadget(`<div><child-comp></child-comp></div>`)
+		Click(t, g)
+
+		if len(parent.Events) != 0 {
+			t.Errorf("Didn't expect events on parent, got %v", parent.Events)
+		}
+	})
+}
+
+func TestComponentTemplateError(t *testing.T) {
+	g := NewGadget(NewTestBridge())
+	component := g.NewComponent(MakeNamedDummyFactory("x-broken", `<div><p g-fro="i in IntArrayVal"></p></div>`, nil, nil))
+	g.Mount(component)
+	g.SingleLoop()
+
+	if r := g.App.State.ExecutedTree.ToString(); r != "<g-fragment></g-fragment>" {
+		t.Errorf("Expected a broken template to render nothing, got %s", r)
+	}
+}
+
+type ErrorComponent struct {
+	GeneratedComponent
+	Count       int
+	IntArrayVal []int
+	secret      string
+	Errors      []string
+}
+
+func (e *ErrorComponent) HandleError(err error) {
+	e.Errors = append(e.Errors, err.Error())
+}
+
+func TestComponentErrorHandler(t *testing.T) {
+	SetupTestGadget := func(Template string, Components map[string]*ComponentFactory) (*Gadget, *ErrorComponent) {
+		g := NewGadget(NewTestBridge())
+		comp := &ErrorComponent{IntArrayVal: []int{1}, secret: "s"}
+		comp.gTemplate = Template
+		comp.gComponents = Components
+		comp.SetupStorage(NewStructStorage(comp))
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name:    "x-errors",
+			Builder: func() Component { return comp },
+		}))
+		g.SingleLoop()
+		return g, comp
+	}
+
+	TestCases := map[string]struct {
+		Template string
+		Expected string
+	}{
+		"Render error": {`<div><p g-value="Nope"></p></div>`,
+			`could not evaluate g-value: undefined variable Nope (in expression "Nope" at offset 0)`},
+		"Unexported field": {`<div><p g-value="secret"></p></div>`,
+			`could not evaluate g-value: undefined variable secret (in expression "secret" at offset 0)`},
+		"Child error": {`<div><x-child :BoolVal="IntArrayVal"></x-child></div>`,
+			`component x-child: prop BoolVal: can't use []int as bool`},
+		"Child render error": {`<div><x-broken></x-broken></div>`,
+			`could not evaluate g-value: index 3 out of range (length 0) (in expression "IntArrayVal[3]" at offset 11)`},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			_, comp := SetupTestGadget(TestCase.Template, map[string]*ComponentFactory{
+				"x-child":  MakeNamedDummyFactory("x-child", "<b></b>", nil, []string{"BoolVal"}),
+				"x-broken": MakeNamedDummyFactory("x-broken", `<b g-value="IntArrayVal[3]"></b>`, nil, nil),
+			})
+
+			if r := strings.Join(comp.Errors, "\n"); r != TestCase.Expected {
+				t.Errorf("Expected error %q, got %q", TestCase.Expected, r)
+			}
+		})
+	}
+
+	t.Run("Test child template error", func(t *testing.T) {
+		_, comp := SetupTestGadget(`<div><x-bad></x-bad></div>`, map[string]*ComponentFactory{
+			"x-bad": MakeNamedDummyFactory("x-bad", `<b g-fro="i in IntArrayVal"></b>`, nil, nil),
+		})
+
+		if len(comp.Errors) != 1 || !strings.HasPrefix(comp.Errors[0], "x-bad:1:4: unknown directive g-fro") {
+			t.Errorf("Expected the template error to reach the parent, got %q", comp.Errors)
+		}
+	})
+
+	t.Run("Test g-model error", func(t *testing.T) {
+		g, comp := SetupTestGadget(`<div><input g-model="Count"></div>`, nil)
+		(&SyncAction{component: g.App, node: vtree.El("input"), key: "Count",
+			state: vtree.ControlState{Value: "many"}}).Run()
+
+		if r := strings.Join(comp.Errors, "\n"); r != `Count: can't convert "many" to int: strconv.ParseInt: parsing "many": invalid syntax` {
+			t.Errorf("Didn't get expected error, got %q", r)
+		}
+	})
+
+	t.Run("Test SetValue", func(t *testing.T) {
+		g, comp := SetupTestGadget(`<div></div>`, nil)
+
+		if err := g.App.SetValue("Count", "3"); err != nil || comp.Count != 3 {
+			t.Errorf("Expected the value to be converted, got %d (%v)", comp.Count, err)
+		}
+		err := g.App.SetValue("Count", "many")
+		if _, ok := err.(*ConversionError); !ok {
+			t.Errorf("Expected a *ConversionError, got %#v", err)
+		}
+		if _, err := g.App.GetValue("secret"); err == nil {
+			t.Errorf("Expected an error for an unexported field")
+		}
+		if len(comp.Errors) != 0 {
+			t.Errorf("Expected returned errors not to be handled, got %v", comp.Errors)
+		}
+	})
+}
@@ -0,0 +1,80 @@
+package gadget
+
+import (
+	"reflect"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+/*
+ * Computed properties are values derived from a component's data, e.g.
+ *
+ * func (c *TodoComponent) Computed() map[string]func() interface{} {
+ *     return map[string]func() interface{}{
+ *         "Remaining": func() interface{} {
+ *             return countOpen(c.Data().RawGetValue("Todos").([]Todo))
+ *         },
+ *     }
+ * }
+ *
+ * Templates use them like fields (g-value="Remaining"). A value is cached
+ * until the storage keys it read change. Only reads through the storage
+ * (RawGetValue) can be tracked: a computed that reads the component's fields
+ * directly is computed again whenever any key changed.
+ */
+type ComputedComponent interface {
+	Computed() map[string]func() interface{}
+}
+
+type computedValue struct {
+	value interface{}
+	// the keys read, nil if they're unknown
+	deps []string
+}
+
+// stale tells if a cached value must be computed again
+func (c *computedValue) stale(changed map[string]bool) bool {
+	if c.deps == nil {
+		return len(changed) > 0
+	}
+	for _, key := range c.deps {
+		if changed[key] {
+			return true
+		}
+	}
+	return false
+}
+
+// pushComputed evaluates the component's computed properties, or takes
+// them from the cache, and pushes them on context
+func (ci *ComponentInstance) pushComputed(context *vtree.Context) {
+	cc, ok := ci.Comp.(ComputedComponent)
+	if !ok {
+		return
+	}
+	// Without tracking nothing can be cached
+	ts, tracking := ci.Comp.Data().(TrackingStorage)
+	if !tracking || ci.State.invalid || ci.State.computed == nil {
+		ci.State.computed = make(map[string]*computedValue)
+	}
+	changed := make(map[string]bool)
+	if tracking {
+		for _, key := range ci.State.changes {
+			changed[key] = true
+		}
+	}
+
+	for name, f := range cc.Computed() {
+		cached, ok := ci.State.computed[name]
+		if !ok || cached.stale(changed) {
+			cached = &computedValue{}
+			if tracking {
+				cached.deps = ts.TrackReads(func() { cached.value = f() })
+			} else {
+				cached.value = f()
+			}
+			ci.State.computed[name] = cached
+		}
+		context.PushValue(name, reflect.ValueOf(cached.value))
+	}
+}
@@ -0,0 +1,97 @@
+package gadget
+
+import (
+	"testing"
+)
+
+type ComputedTodoComponent struct {
+	GeneratedComponent
+	Todos []Todo
+	Title string
+	Calls map[string]int
+}
+
+func (c *ComputedTodoComponent) Computed() map[string]func() interface{} {
+	return map[string]func() interface{}{
+		"Remaining": func() interface{} {
+			c.Calls["Remaining"]++
+			remaining := 0
+			for _, todo := range c.Data().RawGetValue("Todos").([]Todo) {
+				if !todo.Done {
+					remaining++
+				}
+			}
+			return remaining
+		},
+		// reads the field directly, its dependencies are unknown
+		"Upper": func() interface{} {
+			c.Calls["Upper"]++
+			return c.Title + "!"
+		},
+	}
+}
+
+func TestComputed(t *testing.T) {
+	SetupTestGadget := func() (*Gadget, *ComputedTodoComponent) {
+		g := NewGadget(NewTestBridge())
+		comp := &ComputedTodoComponent{
+			Todos: []Todo{{1, "write", false}, {2, "test", true}},
+			Title: "todo",
+			Calls: make(map[string]int),
+		}
+		comp.gTemplate = `<div><h1 g-value="Upper"></h1><p g-value="Remaining"></p></div>`
+		comp.SetupStorage(NewStructStorage(comp))
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name:    "computed",
+			Builder: func() Component { return comp },
+		}))
+		g.SingleLoop()
+		return g, comp
+	}
+
+	t.Run("Test rendered", func(t *testing.T) {
+		g, _ := SetupTestGadget()
+
+		if r := g.App.State.ExecutedTree.ToString(); r != "<div><h1>todo!</h1><p>1</p></div>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test cached", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		comp.Title = "list"
+		g.SingleLoop()
+
+		if r := g.App.State.ExecutedTree.ToString(); r != "<div><h1>list!</h1><p>1</p></div>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+		if comp.Calls["Remaining"] != 1 {
+			t.Errorf("Expected Remaining to be cached, computed %d times", comp.Calls["Remaining"])
+		}
+		if comp.Calls["Upper"] != 2 {
+			t.Errorf("Expected Upper to be computed again, computed %d times", comp.Calls["Upper"])
+		}
+	})
+
+	t.Run("Test dependency changed", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		comp.Todos[0].Done = true
+		g.SingleLoop()
+
+		if r := g.App.State.ExecutedTree.ToString(); r != "<div><h1>todo!</h1><p>0</p></div>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+		if comp.Calls["Remaining"] != 2 {
+			t.Errorf("Expected Remaining to be computed again, computed %d times", comp.Calls["Remaining"])
+		}
+	})
+
+	t.Run("Test nothing changed", func(t *testing.T) {
+		g, comp := SetupTestGadget()
+		g.SingleLoop()
+
+		if comp.Calls["Remaining"] != 1 || comp.Calls["Upper"] != 1 {
+			t.Errorf("Expected nothing to be computed again, got %v", comp.Calls)
+		}
+	})
+}
@@ -1,8 +1,8 @@
 package gadget
 
 import (
-	"fmt"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/go-gadget/gadget/j"
@@ -17,11 +17,15 @@ type Gadget struct {
 	Update      chan Action
 	Bridge      vtree.Subject
 	Queue       []Action
+	queueLock   sync.Mutex // MainLoop queues what arrives on Update concurrently
 	Wakeup      chan bool
 	App         *ComponentInstance
 	RouterState *RouterState
 	Traverser   *RouteTraverser
 	Registry    *Registry
+	IDs         *vtree.IDSource // where the elements of its components get their ids
+	// hooks to run once the current loop's changes are applied
+	hooks []func()
 }
 
 func NewGadget(bridge vtree.Subject) *Gadget {
@@ -33,6 +37,7 @@ func NewGadget(bridge vtree.Subject) *Gadget {
 		Bridge:      bridge,
 		Wakeup:      make(chan bool),
 		RouterState: NewRouterState(registry),
+		IDs:         &vtree.IDSource{Prefix: "g"}, // prefixed, El's ids are plain numbers
 	}
 	g.App = g.NewComponent(GenerateComponentFactory("gadget.gadget.App", "<div>App<router-view></router-view></div>", nil, nil))
 	g.Registry.Register("gadget", g)
@@ -53,17 +58,38 @@ func (g *Gadget) Mount(c *ComponentInstance) {
 	g.App = c
 }
 
-func (g *Gadget) SyncState(Tree vtree.Node) {
-	// Track which components actually have bindings
-	el, ok := Tree.(*vtree.Element)
-	if !ok {
-		return
-	}
-	g.Bridge.SyncState(Tree)
+// AfterApply schedules hook to run after the changes of the current loop
+// have been applied to the bridge
+func (g *Gadget) AfterApply(hook func()) {
+	g.hooks = append(g.hooks, hook)
+}
 
-	for _, c := range el.Children {
-		g.SyncState(c)
+// enqueue adds action to the Queue and returns the size it had before
+func (g *Gadget) enqueue(action Action) int {
+	g.queueLock.Lock()
+	defer g.queueLock.Unlock()
+	size := len(g.Queue)
+	g.Queue = append(g.Queue, action)
+	return size
+}
+
+// dequeue takes the first action from the Queue, nil if it's empty
+func (g *Gadget) dequeue() Action {
+	g.queueLock.Lock()
+	defer g.queueLock.Unlock()
+	if len(g.Queue) == 0 {
+		return nil
 	}
+	work := g.Queue[0]
+	g.Queue = g.Queue[1:]
+	return work
+}
+
+// queued tells how many actions are in the Queue
+func (g *Gadget) queued() int {
+	g.queueLock.Lock()
+	defer g.queueLock.Unlock()
+	return len(g.Queue)
 }
 
 func GetGadget(registry *Registry) *Gadget {
@@ -72,39 +98,51 @@ func GetGadget(registry *Registry) *Gadget {
 
 func (g *Gadget) NewComponent(b *ComponentFactory) *ComponentInstance {
 	state := &ComponentState{Registry: g.Registry}
-	comp := &ComponentInstance{Comp: b.Builder(), State: state}
+	comp := &ComponentInstance{Name: b.Name, Comp: b.Builder(), State: state, ids: g.IDs}
 
 	comp.Init()
 	return comp
 }
 
-func (g *Gadget) SingleLoop() {
+// maxPasses caps the passes of a loop, watchers that keep changing what
+// they watch would never stop otherwise
+const maxPasses = 10
 
-	// Just sync entire tree. We can optimize this later
-	if g.App.State.ExecutedTree != nil {
-		tree := g.App.State.ExecutedTree
-		g.SyncState(tree)
+func (g *Gadget) SingleLoop() {
+	for pass := 0; pass < maxPasses; pass++ {
+		g.pass()
+		// Watchers are queued while rendering, what they change should
+		// be rendered before the loop is done
+		if g.queued() == 0 {
+			return
+		}
 	}
+	j.J("Giving up, watchers keep queueing actions")
+}
 
-	for len(g.Queue) > 0 {
+// pass runs the queued actions and renders the app
+func (g *Gadget) pass() {
+	// Controls sync themselves through SyncActions when they change,
+	// so there's no need to read back state from the bridge here
+	for work := g.dequeue(); work != nil; work = g.dequeue() {
 		// continue until queue is completely empty (could be infinite, so cap?)
-
-		work := g.Queue[0]
-		g.Queue = g.Queue[1:]
-
-		fmt.Printf("Work found: %#v, remain %d\n", work, len(g.Queue))
 		work.Run()
-		fmt.Printf("Done running\n")
 	}
 
 	g.Traverser = NewRouteTraverser(g.RouterState.CurrentRoute)
-
-	fmt.Printf("New traverser created, level %d\n", g.Traverser.level)
 	changes := g.App.BuildDiff(nil, g.Traverser)
 
 	changes.ApplyChanges(g.Bridge)
-	fmt.Println("===== Mounts after loop ======")
-	DumpMounts(g.App, 0)
+	// Server-rendered markup only exists for the first loop
+	if h, ok := g.Bridge.(vtree.Hydrater); ok {
+		h.EndHydration()
+	}
+
+	hooks := g.hooks
+	g.hooks = nil
+	for _, hook := range hooks {
+		hook()
+	}
 }
 
 func (g *Gadget) MainLoop() {
@@ -121,14 +159,9 @@ func (g *Gadget) MainLoop() {
 
 	go func() {
 		for {
-			fmt.Println("Ready to read tasks")
 			msg := <-g.Update
 
-			size := len(g.Queue)
-			// lock?
-			g.Queue = append(g.Queue, msg)
-
-			if size == 0 {
+			if g.enqueue(msg) == 0 {
 				g.Wakeup <- true
 			}
 		}
@@ -328,6 +328,222 @@ func TestForComponent(t *testing.T) {
 	})
 }
 
+func TestFragmentComponent(t *testing.T) {
+	SetupTestGadget := func(ChildTemplate string) (*Gadget, *TestBridge, *ComponentInstance) {
+		tb := NewTestBridge()
+		g := NewGadget(tb)
+		ChildComponentFactory := MakeDummyFactory(ChildTemplate, nil, nil)
+		component := g.NewComponent(MakeDummyFactory(
+			`<div><test-child g-if="!BoolVal"></test-child></div>`,
+			map[string]*ComponentFactory{"test-child": ChildComponentFactory},
+			nil,
+		))
+		g.Mount(component)
+		return g, tb, component
+	}
+
+	t.Run("Test several roots", func(t *testing.T) {
+		g, tb, _ := SetupTestGadget(`<h1>Title</h1><p>Text</p>`)
+		g.SingleLoop()
+
+		rendered := g.App.State.Mounts[0].Component.State.ExecutedTree.ToString()
+		if rendered != "<g-fragment><h1>Title</h1><p>Text</p></g-fragment>" {
+			t.Errorf("Did not get expected rendered tree, got %s", rendered)
+		}
+		// The parent's tree and the child's fragment
+		if tb.AddCount != 2 {
+			t.Errorf("Expected 2 adds, got %d", tb.AddCount)
+		}
+	})
+
+	t.Run("Test root g-if", func(t *testing.T) {
+		g, _, _ := SetupTestGadget(`<b g-if="BoolVal">I am the child</b>`)
+		g.SingleLoop()
+
+		child := g.App.State.Mounts[0].Component
+		if rendered := child.State.ExecutedTree.ToString(); rendered != "<g-fragment></g-fragment>" {
+			t.Errorf("Did not get expected rendered tree, got %s", rendered)
+		}
+
+		child.RawSetValue("BoolVal", true)
+		g.SingleLoop()
+
+		if rendered := child.State.ExecutedTree.ToString(); rendered != "<g-fragment><b>I am the child</b></g-fragment>" {
+			t.Errorf("Did not get expected rendered tree, got %s", rendered)
+		}
+	})
+
+	t.Run("Test root g-for", func(t *testing.T) {
+		g, tb, _ := SetupTestGadget(`<b g-for="i in IntArrayVal" g-value="i"></b>`)
+		g.SingleLoop()
+
+		child := g.App.State.Mounts[0].Component
+		child.RawSetValue("IntArrayVal", []int{1, 2})
+		tb.Reset()
+		g.SingleLoop()
+
+		if rendered := child.State.ExecutedTree.ToString(); rendered != "<g-fragment><b>1</b><b>2</b></g-fragment>" {
+			t.Errorf("Did not get expected rendered tree, got %s", rendered)
+		}
+		if tb.AddCount != 2 {
+			t.Errorf("Expected 2 adds, got %d", tb.AddCount)
+		}
+	})
+
+	t.Run("Test removal", func(t *testing.T) {
+		g, tb, component := SetupTestGadget(`<h1>Title</h1><p>Text</p>`)
+		g.SingleLoop()
+		component.RawSetValue("BoolVal", true)
+		tb.Reset()
+		g.SingleLoop()
+
+		if len(g.App.State.Mounts) != 0 {
+			t.Errorf("Expected 0 mounted components, found %d", len(g.App.State.Mounts))
+		}
+		// The component element and the component's fragment
+		if tb.DeleteCount != 2 {
+			t.Errorf("Expected 2 deletes, got %d", tb.DeleteCount)
+		}
+	})
+}
+
+type DynamicComponent struct {
+	GeneratedComponent
+	Current *ComponentFactory
+}
+
+// FreshFactoriesComponent builds new factories whenever they're asked for
+type FreshFactoriesComponent struct {
+	GeneratedComponent
+	StringVal string
+	Is        string
+}
+
+func (c *FreshFactoriesComponent) Components() map[string]*ComponentFactory {
+	return map[string]*ComponentFactory{"x-a": MakeNamedDummyFactory("a", "<b>A</b>", nil, nil)}
+}
+
+func TestDynamicComponent(t *testing.T) {
+	AFactory := MakeNamedDummyFactory("a", "<b>A</b>", nil, nil)
+	BFactory := MakeNamedDummyFactory("b", "<i>B</i>", nil, nil)
+
+	SetupTestGadget := func(Template string) (*Gadget, *TestBridge, *ComponentInstance) {
+		tb := NewTestBridge()
+		g := NewGadget(tb)
+		component := g.NewComponent(MakeDummyFactory(
+			Template,
+			map[string]*ComponentFactory{"x-a": AFactory, "x-b": BFactory},
+			nil,
+		))
+		g.Mount(component)
+		return g, tb, component
+	}
+
+	t.Run("Test by name", func(t *testing.T) {
+		g, _, component := SetupTestGadget(`<div><component :is="StringVal"></component></div>`)
+		component.RawSetValue("StringVal", "x-b")
+		g.SingleLoop()
+
+		if len(g.App.State.Mounts) != 1 {
+			t.Fatalf("Expected 1 mounted component, found %d", len(g.App.State.Mounts))
+		}
+		if r := FlattenComponents(g.App).ToString(); r != `<div><component is="x-b"><i>B</i></component></div>` {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test static name", func(t *testing.T) {
+		g, _, _ := SetupTestGadget(`<div><component is="x-a"></component></div>`)
+		g.SingleLoop()
+
+		if r := FlattenComponents(g.App).ToString(); r != `<div><component is="x-a"><b>A</b></component></div>` {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test by factory", func(t *testing.T) {
+		g := NewGadget(NewTestBridge())
+		parent := &DynamicComponent{Current: AFactory}
+		parent.gTemplate = `<div><component :is="Current"></component></div>`
+		parent.SetupStorage(NewStructStorage(parent))
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name:    "parent",
+			Builder: func() Component { return parent },
+		}))
+		g.SingleLoop()
+
+		if len(g.App.State.Mounts) != 1 || g.App.State.Mounts[0].Factory != AFactory {
+			t.Errorf("Expected the factory to be mounted")
+		}
+		if r := FlattenComponents(g.App).ToString(); r != "<div><component><b>A</b></component></div>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test switching", func(t *testing.T) {
+		g, tb, component := SetupTestGadget(`<div><component :is="StringVal"></component></div>`)
+		component.RawSetValue("StringVal", "x-a")
+		g.SingleLoop()
+		old := g.App.State.Mounts[0]
+
+		component.RawSetValue("StringVal", "x-b")
+		tb.Reset()
+		g.SingleLoop()
+
+		if len(g.App.State.Mounts) != 1 {
+			t.Fatalf("Expected 1 mounted component, found %d", len(g.App.State.Mounts))
+		}
+		if g.App.State.Mounts[0] == old || g.App.State.Mounts[0].Name != "b" {
+			t.Errorf("Expected b to replace a")
+		}
+		if r := FlattenComponents(g.App).ToString(); r != `<div><component is="x-b"><i>B</i></component></div>` {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+		if tb.DeleteCount != 1 || tb.AddCount != 1 {
+			t.Errorf("Expected a's tree to be deleted and b's added, got %d deletes, %d adds", tb.DeleteCount, tb.AddCount)
+		}
+	})
+
+	FreshTemplates := map[string]string{
+		"element":           `<div><x-a></x-a><p g-value="StringVal"></p></div>`,
+		"component by name": `<div><component :is="Is"></component><p g-value="StringVal"></p></div>`,
+	}
+
+	for Name, Template := range FreshTemplates {
+		t.Run("Test fresh factories, "+Name, func(t *testing.T) {
+			g := NewGadget(NewTestBridge())
+			parent := &FreshFactoriesComponent{Is: "x-a"}
+			parent.gTemplate = Template
+			parent.SetupStorage(NewStructStorage(parent))
+			g.Mount(g.NewComponent(&ComponentFactory{
+				Name:    "parent",
+				Builder: func() Component { return parent },
+			}))
+			g.SingleLoop()
+			child := g.App.State.Mounts[0].Component
+
+			parent.StringVal = "changed"
+			g.SingleLoop()
+
+			if len(g.App.State.Mounts) != 1 || g.App.State.Mounts[0].Component != child {
+				t.Errorf("Expected the child to stay mounted")
+			}
+		})
+	}
+
+	t.Run("Test empty", func(t *testing.T) {
+		g, _, component := SetupTestGadget(`<div><component :is="StringVal"></component></div>`)
+		component.RawSetValue("StringVal", "x-a")
+		g.SingleLoop()
+		component.RawSetValue("StringVal", "")
+		g.SingleLoop()
+
+		if len(g.App.State.Mounts) != 0 {
+			t.Errorf("Expected 0 mounted components, found %d", len(g.App.State.Mounts))
+		}
+	})
+}
+
 func TestComponentArgs(t *testing.T) {
 	SetupTestGadget := func(Props []string) (*Gadget, *TestBridge, *ComponentInstance) {
 		tb := NewTestBridge()
@@ -366,9 +582,6 @@ func TestComponentArgs(t *testing.T) {
 			nil,
 			[]string{"StringVal"},
 		)
-		// Because the parser assumes the ":" is actually a namespace separator,
-		// it will get removed. Hence, in a template, you need to use a double ::
-		// (or use g-bind:attr)
 		component := g.NewComponent(MakeDummyFactory(
 			`<div><test-child g-bind:StringVal="StringVal"></test-child></div>`,
 			map[string]*ComponentFactory{"test-child": ChildComponentFactory}, nil,
@@ -604,10 +817,143 @@ func TestRoutes(t *testing.T) {
 
 		AssertMountsAtLevel(t, g, 0, 1)
 		AssertTemplateAtLevel(t, g, 2, "<div>1<router-view></router-view></div>")
-		// At level 2 we still have the <x-component> mount, but itself has no mounts.
+		// At level 2 we still have the <router-view> mount, but itself has no mounts.
 		AssertMountsAtLevel(t, g, 2, 1)
 		AssertMountsAtLevel(t, g, 3, 0)
 	})
 	// Stuff to test:
 	// Route doesn't change, param changes -> verify component updates (e.g. id)
 }
+
+func TestCleanComponents(t *testing.T) {
+	SetupTestGadget := func() (*Gadget, *DummyComponent, *DummyComponent) {
+		g := NewGadget(NewTestBridge())
+		var child *DummyComponent
+		childFactory := &ComponentFactory{
+			Name: "x-child",
+			Builder: func() Component {
+				child = &DummyComponent{}
+				child.gTemplate = `<b g-value="StringVal"></b>`
+				child.gProps = []string{"BoolVal"}
+				child.SetupStorage(NewStructStorage(child))
+				return child
+			},
+		}
+		component := g.NewComponent(MakeDummyFactory(`<div><p g-value="StringVal"></p><x-child :BoolVal="BoolVal"></x-child></div>`,
+			map[string]*ComponentFactory{"x-child": childFactory}, nil))
+		g.Mount(component)
+		g.SingleLoop()
+		return g, component.Comp.(*DummyComponent), child
+	}
+	Trees := func(g *Gadget) (*vtree.Element, *vtree.Element) {
+		return g.App.State.ExecutedTree, g.App.State.Mounts[0].Component.State.ExecutedTree
+	}
+
+	t.Run("Test nothing changed", func(t *testing.T) {
+		g, _, _ := SetupTestGadget()
+		parentTree, childTree := Trees(g)
+		g.SingleLoop()
+
+		if p, c := Trees(g); p != parentTree || c != childTree {
+			t.Errorf("Expected neither component to be rendered again")
+		}
+	})
+
+	t.Run("Test child changed", func(t *testing.T) {
+		g, _, child := SetupTestGadget()
+		parentTree, childTree := Trees(g)
+		child.StringVal = "changed"
+		g.SingleLoop()
+
+		p, c := Trees(g)
+		if p != parentTree {
+			t.Errorf("Expected the parent not to be rendered again")
+		}
+		if c == childTree || c.ToString() != "<b>changed</b>" {
+			t.Errorf("Expected the child to be rendered again, got %s", c.ToString())
+		}
+	})
+
+	t.Run("Test parent changed", func(t *testing.T) {
+		g, parent, _ := SetupTestGadget()
+		parentTree, childTree := Trees(g)
+		parent.StringVal = "changed"
+		g.SingleLoop()
+
+		p, c := Trees(g)
+		if p == parentTree || p.Children[0].(*vtree.Element).Children[0].(*vtree.Text).Text != "changed" {
+			t.Errorf("Expected the parent to be rendered again")
+		}
+		if c != childTree {
+			t.Errorf("Expected the child with unchanged props not to be rendered again")
+		}
+	})
+
+	t.Run("Test props changed", func(t *testing.T) {
+		g, parent, child := SetupTestGadget()
+		_, childTree := Trees(g)
+		parent.BoolVal = true
+		g.SingleLoop()
+
+		if _, c := Trees(g); c == childTree || !child.BoolVal {
+			t.Errorf("Expected the child to get its prop and be rendered again")
+		}
+	})
+
+	SetupSlotGadget := func() (*Gadget, *TestBridge, *DummyComponent, *DummyComponent) {
+		tb := NewTestBridge()
+		g := NewGadget(tb)
+		var wrap, inner *DummyComponent
+		Factory := func(name string, template string, c **DummyComponent) *ComponentFactory {
+			return &ComponentFactory{
+				Name: name,
+				Builder: func() Component {
+					*c = &DummyComponent{}
+					(*c).gTemplate = template
+					(*c).SetupStorage(NewStructStorage(*c))
+					return *c
+				},
+			}
+		}
+		g.Mount(g.NewComponent(MakeDummyFactory(`<div><x-wrap><x-inner></x-inner></x-wrap></div>`,
+			map[string]*ComponentFactory{
+				"x-wrap":  Factory("x-wrap", `<section><i g-value="StringVal"></i><slot></slot></section>`, &wrap),
+				"x-inner": Factory("x-inner", `<b g-value="StringVal"></b>`, &inner),
+			}, nil)))
+		g.SingleLoop()
+		tb.Reset()
+		return g, tb, wrap, inner
+	}
+
+	t.Run("Test slotted child changed", func(t *testing.T) {
+		g, tb, _, inner := SetupSlotGadget()
+		inner.StringVal = "changed"
+		g.SingleLoop()
+
+		if tb.ReplaceCount != 1 {
+			t.Errorf("Expected the slotted child's change to be applied, got %d replaces", tb.ReplaceCount)
+		}
+	})
+
+	t.Run("Test slot owner and slotted child changed", func(t *testing.T) {
+		g, tb, wrap, inner := SetupSlotGadget()
+		wrap.StringVal = "changed"
+		inner.StringVal = "changed"
+		g.SingleLoop()
+
+		if tb.ReplaceCount != 2 {
+			t.Errorf("Expected both changes to be applied, got %d replaces", tb.ReplaceCount)
+		}
+	})
+
+	t.Run("Test invalidate", func(t *testing.T) {
+		g, _, _ := SetupTestGadget()
+		parentTree, _ := Trees(g)
+		g.App.Invalidate()
+		g.SingleLoop()
+
+		if p, _ := Trees(g); p == parentTree {
+			t.Errorf("Expected an invalidated component to be rendered again")
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package gadget
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/go-gadget/gadget/j"
+	"github.com/go-gadget/gadget/vtree"
+)
+
+// A ConversionError is returned when a string (e.g. a control's value) can't
+// be converted to the type of the value it's bound to
+type ConversionError struct {
+	Key   string
+	Value string
+	Type  reflect.Type
+	Err   error
+}
+
+func (e *ConversionError) Error() string {
+	msg := fmt.Sprintf("can't convert %q to %s: %s", e.Value, e.Type, e.Err)
+	if e.Key == "" {
+		return msg
+	}
+	return e.Key + ": " + msg
+}
+
+// SyncAction syncs a g-model after its control changed
+type SyncAction struct {
+	component *ComponentInstance
+	node      *vtree.Element
+	key       string
+	modifiers []string
+	state     vtree.ControlState
+}
+
+func (a *SyncAction) Run() {
+	if err := a.component.UpdateModel(a.key, a.node, a.modifiers, a.state); err != nil {
+		a.component.reportError(err)
+	}
+}
+
+/*
+ * ErrorHandlerComponent can be implemented by components that handle the
+ * errors that can't be returned to them: an expression that can't be
+ * rendered, a g-model value that can't be converted, an invalid prop.
+ *
+ * An error goes to the component it happens in or, if that doesn't handle
+ * errors, to the closest component it's mounted in that does. If none does,
+ * it's logged. Either way the app keeps running.
+ */
+type ErrorHandlerComponent interface {
+	HandleError(err error)
+}
+
+// reportError reports errors that can't be returned to the user's code,
+// e.g. because they happen while handling an event
+func (ci *ComponentInstance) reportError(err error) {
+	for c := ci; c != nil; c = c.State.Parent {
+		if h, ok := c.Comp.(ErrorHandlerComponent); ok {
+			h.HandleError(err)
+			return
+		}
+		if c.State == nil {
+			break
+		}
+	}
+	j.J("Component error", err.Error())
+}
+
+/*
+ * UpdateModel stores the state of node's control in key, converted to key's
+ * type:
+ *
+ * - checkboxes set a bool, or add/remove their value to/from a slice
+ * - radio buttons set their value when checked
+ * - a <select multiple> sets a slice
+ * - anything else sets its value
+ *
+ * If key doesn't have a (usable) type, e.g. it's not in a MapStorage yet,
+ * values are stored as strings, or as numbers when .number is used.
+ */
+func (ci *ComponentInstance) UpdateModel(key string, node *vtree.Element, modifiers []string, state vtree.ControlState) error {
+	data := ci.Comp.Data()
+
+	t, err := modelType(data, key)
+	if err != nil {
+		return err
+	}
+	m := &model{key: key, modifiers: modifiers}
+
+	var value reflect.Value
+
+	switch vtree.ControlKind(node) {
+	case vtree.CheckboxControl:
+		// a key that's not there yet is unchecked
+		current, _ := data.GetValue(key)
+		value, err = m.checkbox(t, current, state)
+	case vtree.RadioControl:
+		if !state.Checked {
+			// only the checked radio button of a group updates
+			return nil
+		}
+		value, err = m.convert(state.Value, t)
+	case vtree.MultiControl:
+		value, err = m.multiple(t, state.Values)
+	default:
+		value, err = m.convert(state.Value, t)
+	}
+	if err != nil {
+		return err
+	}
+	// Setting doesn't trigger a new Action
+	return data.SetValue(key, value.Interface())
+}
+
+// modelType returns the type of key in data, nil if it doesn't have one.
+// key may be a path, like Address.City
+func modelType(data Storage, key string) (reflect.Type, error) {
+	if s, ok := data.(*StructStorage); ok {
+		p, err := vtree.ParsePath(key)
+		if err != nil {
+			return nil, fmt.Errorf("g-model %q: %s", key, err)
+		}
+		field, err := p.Get(reflect.ValueOf(s.Struct))
+		if err != nil {
+			return nil, fmt.Errorf("g-model %q: %s", key, err)
+		}
+		if field.Kind() == reflect.Interface && field.NumMethod() == 0 {
+			return nil, nil
+		}
+		return field.Type(), nil
+	}
+	if v, err := data.GetValue(key); err == nil && v != nil {
+		return reflect.TypeOf(v), nil
+	}
+	return nil, nil
+}
+
+type model struct {
+	key       string
+	modifiers []string
+}
+
+func (m *model) has(modifier string) bool {
+	for _, mod := range m.modifiers {
+		if mod == modifier {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *model) error(s string, t reflect.Type, err error) error {
+	return &ConversionError{Key: m.key, Value: s, Type: t, Err: err}
+}
+
+// checkbox toggles a bool, or the checkbox' value in a slice
+func (m *model) checkbox(t reflect.Type, current interface{}, state vtree.ControlState) (reflect.Value, error) {
+	if t == nil {
+		return reflect.ValueOf(state.Checked), nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return reflect.ValueOf(state.Checked).Convert(t), nil
+	case reflect.Slice:
+		item, err := m.convert(state.Value, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result := reflect.MakeSlice(t, 0, 0)
+		if cur := reflect.ValueOf(current); cur.IsValid() {
+			for i := 0; i < cur.Len(); i++ {
+				if !reflect.DeepEqual(cur.Index(i).Interface(), item.Interface()) {
+					result = reflect.Append(result, cur.Index(i))
+				}
+			}
+		}
+		if state.Checked {
+			result = reflect.Append(result, item)
+		}
+		return result, nil
+	}
+	return reflect.Value{}, m.error(state.Value, t, fmt.Errorf("a checkbox binds to a bool or a slice"))
+}
+
+// multiple converts the selected options of a <select multiple>
+func (m *model) multiple(t reflect.Type, values []string) (reflect.Value, error) {
+	if t == nil {
+		t = reflect.TypeOf([]string{})
+	}
+	if t.Kind() != reflect.Slice {
+		return reflect.Value{}, m.error(strings.Join(values, ","), t, fmt.Errorf("a multiple select binds to a slice"))
+	}
+	result := reflect.MakeSlice(t, 0, len(values))
+	for _, s := range values {
+		item, err := m.convert(s, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		result = reflect.Append(result, item)
+	}
+	return result, nil
+}
+
+// convert converts a single value to t. An empty value converts to zero
+// for numbers, so clearing a number field doesn't fail
+func (m *model) convert(s string, t reflect.Type) (reflect.Value, error) {
+	if m.has("trim") {
+		s = strings.TrimSpace(s)
+	}
+	if t == nil || (t.Kind() == reflect.Interface && t.NumMethod() == 0) {
+		v := reflect.ValueOf(s)
+		if m.has("number") {
+			if i, err := strconv.Atoi(s); err == nil {
+				v = reflect.ValueOf(i)
+			} else if f, err := strconv.ParseFloat(s, 64); err == nil {
+				v = reflect.ValueOf(f)
+			}
+		}
+		if t != nil {
+			// store as interface{}, e.g. as element of a []interface{}
+			iv := reflect.New(t).Elem()
+			iv.Set(v)
+			return iv, nil
+		}
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(s).Convert(t), nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return reflect.Value{}, m.error(s, t, err)
+		}
+		return reflect.ValueOf(b).Convert(t), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return reflect.Zero(t), nil
+		}
+		i, err := strconv.ParseInt(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, m.error(s, t, err)
+		}
+		return reflect.ValueOf(i).Convert(t), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return reflect.Zero(t), nil
+		}
+		u, err := strconv.ParseUint(s, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, m.error(s, t, err)
+		}
+		return reflect.ValueOf(u).Convert(t), nil
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return reflect.Zero(t), nil
+		}
+		f, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return reflect.Value{}, m.error(s, t, err)
+		}
+		return reflect.ValueOf(f).Convert(t), nil
+	case reflect.Ptr:
+		v, err := m.convert(s, t.Elem())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(v)
+		return p, nil
+	}
+	return reflect.Value{}, m.error(s, t, fmt.Errorf("unsupported type"))
+}
@@ -0,0 +1,237 @@
+package gadget
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+type ModelComponent struct {
+	GeneratedComponent
+	Name     string
+	Age      int
+	Price    float64
+	Done     bool
+	Tags     []string
+	Sizes    []int
+	Nickname *string
+	Any      interface{}
+	Address  *ModelAddress
+	Settings map[string]int
+}
+
+type ModelAddress struct {
+	City string
+}
+
+func SetupModelComponent(Template string) (*Gadget, *ModelComponent) {
+	g := NewGadget(NewTestBridge())
+	comp := &ModelComponent{}
+	comp.gTemplate = Template
+	comp.SetupStorage(NewStructStorage(comp))
+	component := g.NewComponent(&ComponentFactory{
+		Name:    "ModelComponent",
+		Builder: func() Component { return comp },
+	})
+	g.Mount(component)
+	g.SingleLoop()
+	return g, comp
+}
+
+func TestUpdateModel(t *testing.T) {
+	text := vtree.El("input")
+	checkbox := vtree.El("input").A("type", "checkbox")
+	radio := vtree.El("input").A("type", "radio")
+	multiple := vtree.El("select").A("multiple", "multiple")
+
+	TestCases := map[string]struct {
+		Key       string
+		El        *vtree.Element
+		Modifiers []string
+		State     vtree.ControlState
+		Expected  interface{}
+	}{
+		"String":               {"Name", text, nil, vtree.ControlState{Value: " Ivo "}, " Ivo "},
+		"Trimmed string":       {"Name", text, []string{"trim"}, vtree.ControlState{Value: " Ivo "}, "Ivo"},
+		"Int":                  {"Age", text, nil, vtree.ControlState{Value: "42"}, 42},
+		"Empty int":            {"Age", text, nil, vtree.ControlState{Value: ""}, 0},
+		"Float":                {"Price", text, nil, vtree.ControlState{Value: "2.5"}, 2.5},
+		"Pointer":              {"Nickname", text, nil, vtree.ControlState{Value: "iv"}, "iv"},
+		"Untyped":              {"Any", text, nil, vtree.ControlState{Value: "42"}, "42"},
+		"Untyped number":       {"Any", text, []string{"number"}, vtree.ControlState{Value: "42"}, 42},
+		"Untyped float":        {"Any", text, []string{"number"}, vtree.ControlState{Value: "4.2"}, 4.2},
+		"Untyped not number":   {"Any", text, []string{"number"}, vtree.ControlState{Value: "x"}, "x"},
+		"Checkbox":             {"Done", checkbox, nil, vtree.ControlState{Checked: true, Value: "on"}, true},
+		"Checkbox adds":        {"Tags", checkbox, nil, vtree.ControlState{Checked: true, Value: "wasm"}, []string{"go", "wasm"}},
+		"Checkbox removes":     {"Tags", checkbox, nil, vtree.ControlState{Checked: false, Value: "go"}, []string{}},
+		"Checked radio":        {"Age", radio, nil, vtree.ControlState{Checked: true, Value: "7"}, 7},
+		"Unchecked radio":      {"Age", radio, nil, vtree.ControlState{Checked: false, Value: "7"}, 1},
+		"Multiple select":      {"Sizes", multiple, nil, vtree.ControlState{Values: []string{"1", "3"}}, []int{1, 3}},
+		"Multiple select none": {"Sizes", multiple, nil, vtree.ControlState{}, []int{}},
+		"Nested field":         {"Address.City", text, nil, vtree.ControlState{Value: "Utrecht"}, "Utrecht"},
+		"Slice element":        {"Tags[0]", text, nil, vtree.ControlState{Value: "wasm"}, "wasm"},
+		"Map element":          {`Settings["size"]`, text, nil, vtree.ControlState{Value: "3"}, 3},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			comp := &ModelComponent{Age: 1, Tags: []string{"go"}, Address: &ModelAddress{}, Settings: map[string]int{}}
+			comp.SetupStorage(NewStructStorage(comp))
+			ci := &ComponentInstance{Comp: comp}
+
+			if err := ci.UpdateModel(TestCase.Key, TestCase.El, TestCase.Modifiers, TestCase.State); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			value := comp.Data().RawGetValue(TestCase.Key)
+			if p, ok := value.(*string); ok {
+				value = *p
+			}
+			if !reflect.DeepEqual(value, TestCase.Expected) {
+				t.Errorf("Expected %#v, got %#v", TestCase.Expected, value)
+			}
+		})
+	}
+}
+
+func TestUpdateModelErrors(t *testing.T) {
+	TestCases := map[string]struct {
+		Key   string
+		El    *vtree.Element
+		State vtree.ControlState
+	}{
+		"Not a number":          {"Age", vtree.El("input"), vtree.ControlState{Value: "abc"}},
+		"Not a float":           {"Price", vtree.El("input"), vtree.ControlState{Value: "1,5"}},
+		"Checkbox on string":    {"Name", vtree.El("input").A("type", "checkbox"), vtree.ControlState{Checked: true}},
+		"Multiple on int":       {"Age", vtree.El("select").A("multiple", ""), vtree.ControlState{Values: []string{"1"}}},
+		"Multiple bad elements": {"Sizes", vtree.El("select").A("multiple", ""), vtree.ControlState{Values: []string{"x"}}},
+		"Unknown field":         {"Nope", vtree.El("input"), vtree.ControlState{Value: "1"}},
+		"Nil pointer":           {"Address.City", vtree.El("input"), vtree.ControlState{Value: "x"}},
+		"Out of range":          {"Sizes[3]", vtree.El("input"), vtree.ControlState{Value: "1"}},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			comp := &ModelComponent{Age: 1}
+			comp.SetupStorage(NewStructStorage(comp))
+			ci := &ComponentInstance{Comp: comp}
+
+			if err := ci.UpdateModel(TestCase.Key, TestCase.El, nil, TestCase.State); err == nil {
+				t.Errorf("Expected an error")
+			}
+			if comp.Age != 1 {
+				t.Errorf("Expected value to remain unchanged")
+			}
+		})
+	}
+
+	t.Run("Test ConversionError", func(t *testing.T) {
+		comp := &ModelComponent{}
+		comp.SetupStorage(NewStructStorage(comp))
+		ci := &ComponentInstance{Comp: comp}
+
+		err := ci.UpdateModel("Age", vtree.El("input"), nil, vtree.ControlState{Value: "abc"})
+		if ce, ok := err.(*ConversionError); !ok || ce.Key != "Age" || ce.Value != "abc" || ce.Type.Kind() != reflect.Int {
+			t.Errorf("Didn't get expected ConversionError, got %#v", err)
+		}
+	})
+}
+
+func TestUpdateModelMapStorage(t *testing.T) {
+	comp := &DummyComponent{}
+	comp.SetupStorage(NewMapStorage())
+	ci := &ComponentInstance{Comp: comp}
+
+	ci.UpdateModel("count", vtree.El("input"), []string{"number"}, vtree.ControlState{Value: "3"})
+	if v := comp.Data().RawGetValue("count"); v != 3 {
+		t.Errorf("Expected 3, got %#v", v)
+	}
+	// once there's a value, its type is used
+	ci.UpdateModel("count", vtree.El("input"), nil, vtree.ControlState{Value: "4"})
+	if v := comp.Data().RawGetValue("count"); v != 4 {
+		t.Errorf("Expected 4, got %#v", v)
+	}
+}
+
+func TestModelBinding(t *testing.T) {
+	t.Run("Test input syncs and renders", func(t *testing.T) {
+		g, comp := SetupModelComponent(`<div><input g-model.number="Age"/><p g-value="Age + 1"></p></div>`)
+		input := g.App.State.ExecutedTree.Children[0].(*vtree.Element)
+
+		vtree.AssertAttribute(t, input, "value", "0")
+		TriggerEvent(t, g, input, &vtree.Event{Type: "input", Value: "41"})
+		g.SingleLoop()
+
+		if comp.Age != 41 {
+			t.Errorf("Expected Age to be 41, got %d", comp.Age)
+		}
+		tree := g.App.State.ExecutedTree
+		vtree.AssertAttribute(t, tree.Children[0].(*vtree.Element), "value", "41")
+		if r := tree.Children[1].(*vtree.Element).ToString(); r != "<p>42</p>" {
+			t.Errorf("Did not get expected rendered value, got %s", r)
+		}
+	})
+
+	t.Run("Test lazy syncs on change", func(t *testing.T) {
+		g, comp := SetupModelComponent(`<div><input g-model.lazy="Name"/></div>`)
+		input := g.App.State.ExecutedTree.Children[0].(*vtree.Element)
+
+		TriggerEvent(t, g, input, &vtree.Event{Type: "input", Value: "I"})
+		if comp.Name != "" {
+			t.Errorf("Didn't expect input to sync, got %s", comp.Name)
+		}
+		TriggerEvent(t, g, input, &vtree.Event{Type: "change", Value: "Ivo"})
+		if comp.Name != "Ivo" {
+			t.Errorf("Expected change to sync, got %s", comp.Name)
+		}
+	})
+
+	t.Run("Test checkbox group", func(t *testing.T) {
+		g, comp := SetupModelComponent(`<div><input type="checkbox" value="go" g-model="Tags"/>` +
+			`<input type="checkbox" value="wasm" g-model="Tags"/></div>`)
+		tree := g.App.State.ExecutedTree
+
+		TriggerEvent(t, g, tree.Children[1].(*vtree.Element), &vtree.Event{Type: "change", Checked: true, Value: "wasm"})
+		TriggerEvent(t, g, tree.Children[0].(*vtree.Element), &vtree.Event{Type: "change", Checked: true, Value: "go"})
+		g.SingleLoop()
+
+		if !reflect.DeepEqual(comp.Tags, []string{"wasm", "go"}) {
+			t.Errorf("Didn't get expected tags, got %v", comp.Tags)
+		}
+		vtree.AssertAttribute(t, g.App.State.ExecutedTree.Children[0].(*vtree.Element), "checked", "checked")
+	})
+
+	t.Run("Test only the touched control syncs", func(t *testing.T) {
+		g, comp := SetupModelComponent(`<div><input g-model="Name"/><input g-model="Age"/><input g-model="Price"/></div>`)
+		input := g.App.State.ExecutedTree.Children[1].(*vtree.Element)
+
+		done := make(chan bool)
+		go func() {
+			g.Bridge.(*TestBridge).TriggerEvent(input, &vtree.Event{Type: "input", Value: "3"})
+			done <- true
+		}()
+		action := <-g.Update
+		<-done
+
+		sync, ok := action.(*SyncAction)
+		if !ok || sync.node != input {
+			t.Fatalf("Expected a SyncAction for the input, got %#v", action)
+		}
+		g.enqueue(action)
+		g.SingleLoop()
+
+		if comp.Age != 3 || comp.Name != "" || comp.Price != 0 {
+			t.Errorf("Expected only Age to be synced, got %q, %d, %f", comp.Name, comp.Age, comp.Price)
+		}
+	})
+
+	t.Run("Test conversion failure doesn't panic", func(t *testing.T) {
+		g, comp := SetupModelComponent(`<div><input g-model="Age"/></div>`)
+		input := g.App.State.ExecutedTree.Children[0].(*vtree.Element)
+
+		TriggerEvent(t, g, input, &vtree.Event{Type: "input", Value: "abc"})
+		if comp.Age != 0 {
+			t.Errorf("Expected Age to remain 0, got %d", comp.Age)
+		}
+	})
+}
@@ -8,7 +8,28 @@ type Mount struct {
 	Component   *ComponentInstance
 	Point       *vtree.Element
 	Name        string
+	Factory     *ComponentFactory // the factory the component was built by
 	ToBeRemoved bool
+	// the component element was rendered by the last render of the
+	// component it's mounted in, see BuildDiff
+	rendered bool
+}
+
+// replacedBy checks if the mounted component must make way for the one
+// builder builds. Components() may create its factories on every call, so
+// they're compared by name, except for a <component :is> that evaluates to
+// a factory, it can switch between factories with the same name
+func (m *Mount) replacedBy(componentElement *vtree.Element, builder *ComponentFactory) bool {
+	if builder == nil {
+		return true
+	}
+	if is, ok := componentElement.BoundValues["is"]; ok && componentElement.Type == "component" &&
+		is.IsValid() && is.CanInterface() {
+		if _, factory := is.Interface().(*ComponentFactory); factory {
+			return m.Factory != builder
+		}
+	}
+	return m.Name != builder.Name
 }
 
 func (m *Mount) HasComponent(componentElement *vtree.Element) bool {
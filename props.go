@@ -0,0 +1,174 @@
+package gadget
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+/*
+ * A Prop declares a property a component accepts from its parent, e.g.
+ *
+ * Prop{Name: "Count", Default: 10, Validator: positive}
+ *
+ * Props are passed as attributes (<x-counter Count="3">), bound
+ * (<x-counter :Count="n">) or as route parameters. Attributes and route
+ * parameters are strings, they're converted to the prop's Type. If Type
+ * isn't set, the type of the component's storage field is used (if any).
+ */
+type Prop struct {
+	Name      string
+	Type      reflect.Type
+	Default   interface{}
+	Required  bool
+	Validator func(value interface{}) error
+}
+
+// TypedPropsComponent can be implemented by components that declare typed
+// props. It takes precedence over Component.Props()
+type TypedPropsComponent interface {
+	TypedProps() []Prop
+}
+
+// A PropError reports a prop that is missing, can't be converted or
+// is invalid
+type PropError struct {
+	Component string
+	Prop      string
+	Err       error
+}
+
+func (e *PropError) Error() string {
+	return fmt.Sprintf("component %s: prop %s: %s", e.Component, e.Prop, e.Err)
+}
+
+// ErrRequiredProp is the PropError's Err for a missing required prop
+var ErrRequiredProp = errors.New("required prop is missing")
+
+// PropDeclarations returns the props the component accepts. Plain
+// Props() are declared without type, default or validation
+func (ci *ComponentInstance) PropDeclarations() []Prop {
+	if tp, ok := ci.Comp.(TypedPropsComponent); ok {
+		return tp.TypedProps()
+	}
+	var props []Prop
+	for _, name := range ci.Comp.Props() {
+		props = append(props, Prop{Name: name})
+	}
+	return props
+}
+
+// rawProp finds the value passed for a prop: bound, as attribute or as route parameter
+func (ci *ComponentInstance) rawProp(componentElement *vtree.Element, name string) (reflect.Value, bool) {
+	if val, ok := componentElement.BoundValues[name]; ok {
+		return val, true
+	}
+	if val, ok := componentElement.Attributes[name]; ok {
+		return reflect.ValueOf(val), true
+	}
+	if rs, ok := ci.State.Registry.Get("router-state").(*RouterState); ok && rs.CurrentRoute != nil {
+		if val, ok := rs.CurrentRoute.Params[name]; ok {
+			return reflect.ValueOf(val), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// propType determines the type a prop is converted to, nil if it has none
+func (ci *ComponentInstance) propType(prop Prop) reflect.Type {
+	if prop.Type != nil {
+		return prop.Type
+	}
+	if t, err := modelType(ci.Comp.Data(), prop.Name); err == nil {
+		return t
+	}
+	return nil
+}
+
+// coerce converts value to t. Strings are parsed, numbers converted and
+// numbers and bools formatted for strings
+func coerce(value reflect.Value, t reflect.Type) (reflect.Value, error) {
+	if value.Kind() == reflect.Interface && !value.IsNil() {
+		value = value.Elem()
+	}
+	if !value.IsValid() || (value.Kind() == reflect.Interface && value.IsNil()) {
+		if t == nil {
+			return reflect.Value{}, errors.New("can't pass nil without a type")
+		}
+		return reflect.Zero(t), nil
+	}
+	if t == nil || value.Type().AssignableTo(t) {
+		return value, nil
+	}
+	if value.Kind() == reflect.String {
+		// the PropError already names the prop
+		m := &model{}
+		return m.convert(value.String(), t)
+	}
+	if isNumber(value.Kind()) && isNumber(t.Kind()) {
+		return value.Convert(t), nil
+	}
+	if t.Kind() == reflect.String && (isNumber(value.Kind()) || value.Kind() == reflect.Bool) {
+		// like a bound value used to be passed, e.g. :Label="Count"
+		return reflect.ValueOf(vtree.Stringify(value)).Convert(t), nil
+	}
+	return reflect.Value{}, fmt.Errorf("can't use %s as %s", value.Type(), t)
+}
+
+func isNumber(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// extractProp resolves, converts and validates a single prop. If it's
+// not passed and has no default, ok is false
+func (ci *ComponentInstance) extractProp(componentElement *vtree.Element, prop Prop) (value reflect.Value, ok bool, err error) {
+	value, ok = ci.rawProp(componentElement, prop.Name)
+	if !ok {
+		if prop.Required {
+			return value, false, ErrRequiredProp
+		}
+		if prop.Default == nil {
+			return value, false, nil
+		}
+		value = reflect.ValueOf(prop.Default)
+	}
+	if value, err = coerce(value, ci.propType(prop)); err != nil {
+		return value, false, err
+	}
+	if prop.Validator != nil {
+		if err = prop.Validator(value.Interface()); err != nil {
+			return value, false, err
+		}
+	}
+	return value, true, nil
+}
+
+// ExtractProps checks which props a component accepts and fetches these
+// from the element. Invalid props are left out, the first error is returned
+func (ci *ComponentInstance) ExtractProps(componentElement *vtree.Element) ([]*vtree.Variable, error) {
+	var props []*vtree.Variable
+	var firstErr error
+
+	for _, prop := range ci.PropDeclarations() {
+		value, ok, err := ci.extractProp(componentElement, prop)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = &PropError{Component: ci.Name, Prop: prop.Name, Err: err}
+			}
+			continue
+		}
+		if ok {
+			props = append(props, &vtree.Variable{Name: prop.Name, Value: value})
+		}
+	}
+
+	return props, firstErr
+}
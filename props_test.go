@@ -0,0 +1,229 @@
+package gadget
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+type PropsComponent struct {
+	GeneratedComponent
+	Count int
+	Label string
+	Tags  []string
+	Ratio float64
+}
+
+func (p *PropsComponent) TypedProps() []Prop {
+	return []Prop{
+		{Name: "Count", Default: 10, Validator: func(v interface{}) error {
+			if v.(int) < 0 {
+				return errors.New("must not be negative")
+			}
+			return nil
+		}},
+		{Name: "Label", Required: true},
+		{Name: "Tags"},
+		{Name: "Ratio", Type: reflect.TypeOf(float64(0)), Default: 1},
+	}
+}
+
+func MakePropsInstance() (*ComponentInstance, *PropsComponent) {
+	g := NewGadget(NewTestBridge())
+	var comp *PropsComponent
+	ci := g.NewComponent(&ComponentFactory{
+		Name: "x-props",
+		Builder: func() Component {
+			comp = &PropsComponent{}
+			comp.SetupStorage(NewStructStorage(comp))
+			return comp
+		},
+	})
+	return ci, comp
+}
+
+func TestExtractProps(t *testing.T) {
+	PropMap := func(props []*vtree.Variable) map[string]interface{} {
+		res := make(map[string]interface{})
+		for _, p := range props {
+			res[p.Name] = p.Value.Interface()
+		}
+		return res
+	}
+
+	t.Run("Test conversion and defaults", func(t *testing.T) {
+		ci, _ := MakePropsInstance()
+		props, err := ci.ExtractProps(vtree.El("x-props").A("Count", "3").A("Label", "hi"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		expected := map[string]interface{}{"Count": 3, "Label": "hi", "Ratio": float64(1)}
+		if r := PropMap(props); !reflect.DeepEqual(r, expected) {
+			t.Errorf("Expected %v, got %v", expected, r)
+		}
+	})
+
+	t.Run("Test default", func(t *testing.T) {
+		ci, _ := MakePropsInstance()
+		props, _ := ci.ExtractProps(vtree.El("x-props").A("Label", "hi"))
+		if r := PropMap(props)["Count"]; r != 10 {
+			t.Errorf("Expected default 10, got %v", r)
+		}
+	})
+
+	t.Run("Test bound value", func(t *testing.T) {
+		ci, _ := MakePropsInstance()
+		el := vtree.El("x-props")
+		el.BoundValues = map[string]reflect.Value{
+			"Label": reflect.ValueOf(42),
+			"Tags":  reflect.ValueOf([]string{"a", "b"}),
+			"Ratio": reflect.ValueOf(2),
+		}
+		props, err := ci.ExtractProps(el)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		m := PropMap(props)
+		if !reflect.DeepEqual(m["Tags"], []string{"a", "b"}) {
+			t.Errorf("Expected the bound slice, got %#v", m["Tags"])
+		}
+		if m["Ratio"] != float64(2) {
+			t.Errorf("Expected the bound int to be converted, got %#v", m["Ratio"])
+		}
+		if m["Label"] != "42" {
+			t.Errorf("Expected the bound int to be formatted, got %#v", m["Label"])
+		}
+	})
+
+	TestErrors := map[string]struct {
+		El  *vtree.Element
+		Err string
+	}{
+		"Missing required": {vtree.El("x-props"),
+			"component x-props: prop Label: required prop is missing"},
+		"Conversion": {vtree.El("x-props").A("Label", "hi").A("Count", "many"),
+			`component x-props: prop Count: can't convert "many" to int: strconv.ParseInt: parsing "many": invalid syntax`},
+		"Validation": {vtree.El("x-props").A("Label", "hi").A("Count", "-1"),
+			"component x-props: prop Count: must not be negative"},
+	}
+
+	for Name, TestCase := range TestErrors {
+		t.Run(Name, func(t *testing.T) {
+			ci, _ := MakePropsInstance()
+			props, err := ci.ExtractProps(TestCase.El)
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if _, ok := err.(*PropError); !ok {
+				t.Errorf("Expected a *PropError, got %T", err)
+			}
+			if err.Error() != TestCase.Err {
+				t.Errorf("Expected error %q, got %q", TestCase.Err, err.Error())
+			}
+			// Valid props are still passed
+			if len(props) == 0 {
+				t.Errorf("Expected valid props to be extracted")
+			}
+		})
+	}
+}
+
+type CounterComponent struct {
+	GeneratedComponent
+	Count int
+}
+
+func TestPropsRendered(t *testing.T) {
+	SetupTestGadget := func(Template string) *Gadget {
+		g := NewGadget(NewTestBridge())
+		child := &ComponentFactory{
+			Name: "x-child",
+			Builder: func() Component {
+				comp := &CounterComponent{}
+				comp.gTemplate = `<b g-value="Count + 1"></b>`
+				comp.gProps = []string{"Count"}
+				comp.SetupStorage(NewStructStorage(comp))
+				return comp
+			},
+		}
+		component := g.NewComponent(MakeDummyFactory(Template,
+			map[string]*ComponentFactory{"x-child": child}, nil))
+		component.SetValue("IntArrayVal", []int{41})
+		g.Mount(component)
+		g.SingleLoop()
+		return g
+	}
+
+	t.Run("Test plain props are converted", func(t *testing.T) {
+		g := SetupTestGadget(`<div><x-child Count="41"></x-child></div>`)
+
+		if r := g.App.State.Mounts[0].Component.State.ExecutedTree.ToString(); r != "<b>42</b>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test bound props keep their type", func(t *testing.T) {
+		g := SetupTestGadget(`<div><x-child :Count="IntArrayVal[0]"></x-child></div>`)
+
+		if r := g.App.State.Mounts[0].Component.State.ExecutedTree.ToString(); r != "<b>42</b>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+}
+
+type Todo struct {
+	ID    int
+	Title string
+	Done  bool
+}
+
+type TodoListComponent struct {
+	GeneratedComponent
+	Todos []Todo
+	First *Todo
+}
+
+func TestBoundProps(t *testing.T) {
+	g := NewGadget(NewTestBridge())
+	var list *TodoListComponent
+	todoList := &ComponentFactory{
+		Name: "todo-list",
+		Builder: func() Component {
+			list = &TodoListComponent{}
+			list.gTemplate = `<ul><li g-for="todo in Todos" g-key="todo.ID" g-value="todo.Title"></li></ul>`
+			list.gProps = []string{"Todos", "First"}
+			list.SetupStorage(NewStructStorage(list))
+			return list
+		},
+	}
+	parent := &TodoListComponent{Todos: []Todo{{1, "write", false}, {2, "test", true}}}
+	parent.gTemplate = `<div><todo-list :Todos="Todos" :First="First"></todo-list></div>`
+	parent.gComponents = map[string]*ComponentFactory{"todo-list": todoList}
+	parent.First = &parent.Todos[0]
+	parent.SetupStorage(NewStructStorage(parent))
+
+	g.Mount(g.NewComponent(&ComponentFactory{
+		Name:    "parent",
+		Builder: func() Component { return parent },
+	}))
+	g.SingleLoop()
+
+	if r := g.App.State.Mounts[0].Component.State.ExecutedTree.ToString(); r != "<ul><li>write</li><li>test</li></ul>" {
+		t.Errorf("Did not get expected rendered tree, got %s", r)
+	}
+	if list.First != parent.First {
+		t.Errorf("Expected the pointer itself to be passed")
+	}
+	if r := g.App.State.ExecutedTree.ToString(); r != "<div><todo-list></todo-list></div>" {
+		t.Errorf("Expected no stringified props on the component element, got %s", r)
+	}
+
+	parent.Todos = append(parent.Todos, Todo{3, "ship", false})
+	g.SingleLoop()
+
+	if r := g.App.State.Mounts[0].Component.State.ExecutedTree.ToString(); r != "<ul><li>write</li><li>test</li><li>ship</li></ul>" {
+		t.Errorf("Did not get expected rendered tree, got %s", r)
+	}
+}
@@ -243,12 +243,17 @@ func (rs *RouterState) TransitionToPath(path string) {
 	bridge := rs.Registry.Get("bridge").(vtree.Subject)
 	bridge.SetLocation(path)
 
+	rs.resolve(path)
+	rs.Update <- &TransitionAction{oldPath, path}
+}
+
+// resolve makes path the current route, falling back to the 404 route
+func (rs *RouterState) resolve(path string) {
 	rs.CurrentRoute = GetRouter(rs.Registry).Parse(path)
 	if rs.CurrentRoute == nil {
 		// We could inject the actual path into a copy of the 404 route?
 		rs.CurrentRoute = &CurrentRoute{Matches: []*RouteMatch{&RouteMatch{Route: rs.Route404}}}
 	}
-	rs.Update <- &TransitionAction{oldPath, path}
 }
 
 func (rs *RouterState) TransitionToName(name string, params map[string]string) {
@@ -315,22 +320,18 @@ var RouterLinkComponentFactory = &ComponentFactory{
 	},
 }
 
+// RouterViewComponent mounts the component of the current route at its level
 type RouterViewComponent struct {
 	BaseComponent
-	firstSlot  bool
-	secondSlot bool // XXX need "not value" (or g-else) in g-value!
-	level      int
-	state      map[string]*ComponentFactory
-	tpl        string
+	level   int
+	Current *ComponentFactory
 }
 
 func (r *RouterViewComponent) Template() string {
-	return `<div><x-component1 g-if="firstSlot"></x-component1><x-component2 g-if="secondSlot"></x-component2></div>`
+	return `<div><component :is="Current"></component></div>`
 }
 
 func (r *RouterViewComponent) BeforeTraverse() {
-	var m *Mount
-
 	rt := GetGadget(r.State.Registry).Traverser
 	// Have we already been visited?
 	if r.level == -1 {
@@ -340,47 +341,18 @@ func (r *RouterViewComponent) BeforeTraverse() {
 		return
 	}
 
-	r.state = map[string]*ComponentFactory{"x-component1": nil, "x-component2": nil}
-	MountedName := ""
-
-	if len(r.State.Mounts) > 0 {
-		m = r.State.Mounts[0]
-		MountedName = m.Name
-	}
-
-	// c is the component for the current route level
-	c := rt.PopRoute()
-
-	if c == nil {
-		if m != nil {
-			m.ToBeRemoved = true
-		}
-		return
-	}
-
-	if MountedName != c.Route.Component.Name {
-		if m != nil {
-			m.ToBeRemoved = true
-			r.firstSlot = !r.firstSlot
-			r.secondSlot = !r.firstSlot
-		}
+	// c is the component for the current route level. If it changes,
+	// <component :is> replaces the mounted component
+	r.Current = nil
+	if c := rt.PopRoute(); c != nil {
+		r.Current = c.Route.Component
 	}
-
-	slot := "x-component1"
-	if !r.firstSlot {
-		slot = "x-component2"
-	}
-	r.state[slot] = c.Route.Component
-
-}
-func (r *RouterViewComponent) Components() map[string]*ComponentFactory {
-	return r.state
 }
 
 var RouterViewComponentFactory = &ComponentFactory{
 	Name: "gadget.router.RouterView",
 	Builder: func() Component {
-		c := &RouterViewComponent{firstSlot: true, secondSlot: false, level: -1}
+		c := &RouterViewComponent{level: -1}
 		c.SetupStorage(NewStructStorage(c))
 		return c
 	},
@@ -133,3 +133,30 @@ func (rm *RouteMatcher) Params(key string, value string) *RouteMatcher {
 	}
 	return rm
 }
+
+type TraversableComponent struct {
+	GeneratedComponent
+	Traversed int
+}
+
+func (c *TraversableComponent) BeforeTraverse() {
+	c.Traversed++
+}
+
+func TestBeforeTraverse(t *testing.T) {
+	// BeforeTraverse may change what's rendered (router-view does), so it
+	// must run before rendering, also without components in the template
+	g := NewGadget(NewTestBridge())
+	comp := &TraversableComponent{}
+	comp.gTemplate = `<div><p g-value="Traversed"></p></div>`
+	comp.SetupStorage(NewStructStorage(comp))
+	g.Mount(g.NewComponent(&ComponentFactory{
+		Name:    "traversable",
+		Builder: func() Component { return comp },
+	}))
+	g.SingleLoop()
+
+	if r := g.App.State.ExecutedTree.ToString(); r != "<div><p>1</p></div>" {
+		t.Errorf("Expected BeforeTraverse to run once before rendering, got %s", r)
+	}
+}
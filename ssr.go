@@ -0,0 +1,71 @@
+package gadget
+
+import (
+	"io"
+	"strings"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+/*
+ * Server-side rendering renders an app to HTML, so it can be served by a
+ * plain Go HTTP server, e.g. for crawlers or a fast first paint:
+ *
+ * http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+ *     g := NewGadget(vtree.NewDummyBridge())
+ *     g.Router(routes)
+ *     g.Mount(...) // if the app isn't just a <router-view>
+ *     g.RenderHTML(w, r.URL.Path)
+ * })
+ *
+ * A Gadget holds the state of a single app, so build one per request.
+ *
+ * Components are rendered as usual, but nothing gets mounted: Created hooks
+ * run, Mounted hooks don't. Elements are marked with their ids in data-gid.
+ * A client Gadget hands out the same ids, so the DOM bridge can match them
+ * in #gadget-content and hydrate the markup in stead of rendering it again
+ * (see vtree.Hydrate).
+ */
+
+// RenderHTML resolves path with the router (if any), renders the app and
+// writes it to w as HTML
+func (g *Gadget) RenderHTML(w io.Writer, path string) error {
+	if GetRouter(g.Registry) != nil {
+		g.RouterState.resolve(path)
+	}
+	for work := g.dequeue(); work != nil; work = g.dequeue() {
+		work.Run()
+	}
+
+	g.Traverser = NewRouteTraverser(g.RouterState.CurrentRoute)
+	g.App.BuildDiff(nil, g.Traverser)
+	// Nothing was applied to a bridge, so there's nothing mounted either
+	g.hooks = nil
+
+	renderer := &vtree.HTMLRenderer{Markers: true}
+	renderer.Content = func(componentElement *vtree.Element) vtree.Node {
+		return componentContent(g.App, componentElement)
+	}
+	return renderer.Render(w, g.App.State.ExecutedTree)
+}
+
+// RenderString is RenderHTML, returning the HTML as string
+func (g *Gadget) RenderString(path string) (string, error) {
+	var b strings.Builder
+	err := g.RenderHTML(&b, path)
+	return b.String(), err
+}
+
+// componentContent finds the tree of the component mounted on
+// componentElement, somewhere below ci
+func componentContent(ci *ComponentInstance, componentElement *vtree.Element) vtree.Node {
+	for _, m := range ci.State.Mounts {
+		if m.HasComponent(componentElement) {
+			return m.Component.State.ExecutedTree
+		}
+		if content := componentContent(m.Component, componentElement); content != nil {
+			return content
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package gadget
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
+var markerPattern = regexp.MustCompile(` data-gid="[^"]*"`)
+
+func TestRenderHTML(t *testing.T) {
+	UserComponent := &ComponentFactory{
+		Name: "user",
+		Builder: func() Component {
+			c := &PropsComponent{}
+			c.gTemplate = `<div><h1 g-value="Label"></h1><input :value="Count"><button @click="save">Save</button></div>`
+			c.SetupStorage(NewStructStorage(c))
+			return c
+		},
+	}
+	// PropsComponent takes Label and Count, here from the route's params
+	router := Router{
+		Route{Path: "/", Name: "Home", Component: MakeNamedDummyFactory("home", `<p>Home &amp; more</p>`, nil, nil)},
+		Route{Path: "/user/:Label/:Count", Name: "User", Component: UserComponent},
+	}
+
+	Render := func(path string) string {
+		t.Helper()
+		g := NewGadget(vtree.NewDummyBridge())
+		g.Router(router)
+		html, err := g.RenderString(path)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return html
+	}
+
+	TestCases := map[string]struct {
+		Path     string
+		Expected string
+	}{
+		"Home": {"/", `<div>App<router-view><div><component><p>Home &amp; more</p></component></div></router-view></div>`},
+		"Escaped params": {"/user/<b>/3", `<div>App<router-view><div><component><div><h1>&lt;b&gt;</h1>` +
+			`<input value="3"><button>Save</button></div></component></div></router-view></div>`},
+		"Not found": {"/nope", `<div>App<router-view><div><component><div>404 - not found</div></component></div></router-view></div>`},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			if r := markerPattern.ReplaceAllString(Render(TestCase.Path), ""); r != TestCase.Expected {
+				t.Errorf("Expected %s, got %s", TestCase.Expected, r)
+			}
+		})
+	}
+
+	t.Run("Test markers", func(t *testing.T) {
+		g := NewGadget(vtree.NewDummyBridge())
+		g.Router(router)
+		html, _ := g.RenderString("/")
+
+		if c := strings.Count(html, "data-gid="); c != 5 {
+			t.Errorf("Expected 5 marked elements, got %d in %s", c, html)
+		}
+		if !strings.Contains(html, `data-gid="`+string(g.App.State.ExecutedTree.ID)+`"`) {
+			t.Errorf("Expected the app's element to be marked with its id, got %s", html)
+		}
+	})
+
+	t.Run("Test client ids", func(t *testing.T) {
+		server := NewGadget(vtree.NewDummyBridge())
+		server.Router(router)
+		html, _ := server.RenderString("/user/x/1")
+
+		// the client hands out the same ids, so it can hydrate the markup
+		client := NewGadget(NewTestBridge())
+		client.Router(router)
+		go func() {
+			<-client.Update
+		}()
+		client.RouterState.TransitionToPath("/user/x/1")
+		client.SingleLoop()
+		renderer := &vtree.HTMLRenderer{Markers: true, Content: func(el *vtree.Element) vtree.Node {
+			return componentContent(client.App, el)
+		}}
+		if r := renderer.String(client.App.State.ExecutedTree); r != html {
+			t.Errorf("Expected the client's tree to match %s, got %s", html, r)
+		}
+	})
+
+	t.Run("Test concurrent renders", func(t *testing.T) {
+		// a Gadget per request, each hands out the same ids
+		results := make(chan string)
+		for i := 0; i < 8; i++ {
+			go func() {
+				g := NewGadget(vtree.NewDummyBridge())
+				g.Router(router)
+				html, _ := g.RenderString("/user/x/1")
+				results <- html
+			}()
+		}
+		first := <-results
+		for i := 1; i < 8; i++ {
+			if html := <-results; html != first {
+				t.Errorf("Expected the same html for every render, got %s and %s", first, html)
+			}
+		}
+	})
+
+	t.Run("Test Mounted doesn't run", func(t *testing.T) {
+		var log []string
+		g := NewGadget(vtree.NewDummyBridge())
+		g.Mount(g.NewComponent(&ComponentFactory{
+			Name: "lifecycle",
+			Builder: func() Component {
+				c := &LifecycleComponent{Name: "app", Log: &log, Bridge: NewTestBridge()}
+				c.gTemplate = `<div g-value="Name"></div>`
+				c.SetupStorage(NewStructStorage(c))
+				return c
+			},
+		}))
+		html, _ := g.RenderString("/")
+
+		if r := markerPattern.ReplaceAllString(html, ""); r != "<div>app</div>" {
+			t.Errorf("Did not get expected html, got %s", r)
+		}
+		if r := strings.Join(log, ","); r != "app:created" {
+			t.Errorf("Expected only created to run, got %s", r)
+		}
+	})
+}
+
+type HydratingBridge struct {
+	*TestBridge
+	Ended int
+}
+
+func (b *HydratingBridge) EndHydration() {
+	b.Ended++
+}
+
+func TestEndHydration(t *testing.T) {
+	bridge := &HydratingBridge{TestBridge: NewTestBridge()}
+	g := NewGadget(bridge)
+	g.Mount(g.NewComponent(MakeDummyFactory(`<div>Hi</div>`, nil, nil)))
+	g.SingleLoop()
+
+	if bridge.Ended != 1 {
+		t.Errorf("Expected the bridge to be told hydration ended, got %d", bridge.Ended)
+	}
+}
@@ -1,28 +1,329 @@
 package gadget
 
 import (
+	"hash"
+	"hash/fnv"
+	"math"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/go-gadget/gadget/j"
 	"github.com/go-gadget/gadget/vtree"
 )
 
+/*
+ * A Storage holds a component's data. Keys may be paths, like Address.City
+ * or Todos[0].Title (see vtree.Path).
+ *
+ * GetValue and SetValue report what went wrong: a *vtree.PathError for a
+ * key that can't be resolved (an unknown or unexported field, an index out
+ * of range, a nil pointer) and a *ConversionError for a value that can't be
+ * converted to the key's type. RawGetValue and RawSetValue only log errors.
+ */
 type Storage interface {
 	RawSetValue(key string, value interface{})
 	RawGetValue(key string) interface{}
+	// GetValue gets the value of key
+	GetValue(key string) (interface{}, error)
+	// SetValue sets key, converting value to its type where possible,
+	// e.g. "3" to an int
+	SetValue(key string, value interface{}) error
 	MakeContext() *vtree.Context
 }
 
+// getPath resolves a path in root, the first step being a key of root
+func getPath(root reflect.Value, path string) (interface{}, error) {
+	p, err := vtree.ParsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	v, err := p.Get(root)
+	if err != nil {
+		return nil, err
+	}
+	return v.Interface(), nil
+}
+
+// setPath sets a path in root, returning the key that was written
+func setPath(root reflect.Value, path string, value interface{}) (string, error) {
+	p, err := vtree.ParsePath(path)
+	if err != nil {
+		return "", err
+	}
+	current, err := p.Get(root)
+	if err != nil {
+		// Set explains why it can't set it
+		_, err = p.Set(root, reflect.ValueOf(value))
+		return p[0].Name, err
+	}
+	t := current.Type()
+	if t.Kind() == reflect.Interface && t.NumMethod() == 0 {
+		t = nil
+	}
+	if value, err = convertValue(path, value, t); err != nil {
+		return "", err
+	}
+	if _, err := p.Set(root, reflect.ValueOf(value)); err != nil {
+		return "", err
+	}
+	return p[0].Name, nil
+}
+
+// convertValue converts value to t, if it has a type. See coerce
+func convertValue(key string, value interface{}, t reflect.Type) (interface{}, error) {
+	if t == nil {
+		return value, nil
+	}
+	v, err := coerce(reflect.ValueOf(value), t)
+	if err != nil {
+		if ce, ok := err.(*ConversionError); ok {
+			ce.Key = key
+			return nil, ce
+		}
+		return nil, &vtree.PathError{Path: key, Msg: err.Error()}
+	}
+	return v.Interface(), nil
+}
+
+// firstKey is the storage key a path starts with
+func firstKey(path string) string {
+	if i := strings.IndexAny(path, ".["); i > 0 {
+		return path[:i]
+	}
+	return path
+}
+
+/*
+ * TrackingStorage can be implemented by storages that know which of their
+ * keys changed. A component whose storage didn't change (and whose props
+ * didn't either) isn't rendered again, it keeps its ExecutedTree.
+ *
+ * A storage that doesn't implement it is rendered every loop.
+ */
+type TrackingStorage interface {
+	// Changes returns the keys that changed since the last Commit
+	Changes() []string
+	// Commit marks the current values as rendered
+	Commit()
+	// TrackReads runs f and returns the keys it read through RawGetValue
+	TrackReads(f func()) []string
+}
+
+/*
+ * tracker records which keys were written, and fingerprints values so
+ * changes that don't go through the storage are found too, e.g. a handler
+ * doing c.Todos[0].Done = true. Fingerprints follow pointers, slices and
+ * maps, which makes them the expensive part: a written key has changed,
+ * it isn't fingerprinted.
+ */
+type tracker struct {
+	written map[string]bool
+	// fingerprints of the committed values
+	fingerprints map[string]uint64
+	// keys read while tracking reads
+	reads map[string]bool
+}
+
+func (t *tracker) read(key string) {
+	if t.reads != nil {
+		t.reads[key] = true
+	}
+}
+
+func (t *tracker) TrackReads(f func()) []string {
+	outer := t.reads
+	t.reads = make(map[string]bool)
+	f()
+
+	var keys []string
+	for key := range t.reads {
+		keys = append(keys, key)
+		// f's reads are reads of whatever is tracking the outer reads
+		if outer != nil {
+			outer[key] = true
+		}
+	}
+	t.reads = outer
+	sort.Strings(keys)
+	return keys
+}
+
+func (t *tracker) write(key string) {
+	if t.written == nil {
+		t.written = make(map[string]bool)
+	}
+	t.written[key] = true
+}
+
+func (t *tracker) changes(values map[string]reflect.Value) []string {
+	var changed []string
+	for key, value := range values {
+		if old, ok := t.fingerprints[key]; t.written[key] || !ok || old != fingerprint(value) {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func (t *tracker) commit(values map[string]reflect.Value) {
+	t.written = nil
+	t.fingerprints = make(map[string]uint64)
+	for key, value := range values {
+		t.fingerprints[key] = fingerprint(value)
+	}
+}
+
+// fingerprint hashes everything reachable from v
+func fingerprint(v reflect.Value) uint64 {
+	h := fnv.New64a()
+	writeValue(h, v, make(map[uintptr]bool))
+	return h.Sum64()
+}
+
+// cycle checks if v (a pointer, map or slice) is on the current path and
+// otherwise adds it. Only the current path: a pointer that's shared is
+// hashed every time it's found
+func cycle(h hash.Hash64, v reflect.Value, path map[uintptr]bool) bool {
+	if path[v.Pointer()] {
+		h.Write([]byte("cycle"))
+		return true
+	}
+	path[v.Pointer()] = true
+	return false
+}
+
+func writeValue(h hash.Hash64, v reflect.Value, path map[uintptr]bool) {
+	if !v.IsValid() {
+		h.Write([]byte{0})
+		return
+	}
+	h.Write([]byte{byte(v.Kind())})
+
+	switch v.Kind() {
+	case reflect.Bool:
+		h.Write([]byte(strconv.FormatBool(v.Bool())))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		h.Write([]byte(strconv.FormatInt(v.Int(), 10)))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		h.Write([]byte(strconv.FormatUint(v.Uint(), 10)))
+	case reflect.Float32, reflect.Float64:
+		h.Write([]byte(strconv.FormatUint(math.Float64bits(v.Float()), 16)))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		h.Write([]byte(strconv.FormatUint(math.Float64bits(real(c)), 16) + "," +
+			strconv.FormatUint(math.Float64bits(imag(c)), 16)))
+	case reflect.String:
+		// the length keeps "ab","c" apart from "a","bc"
+		h.Write([]byte(strconv.Itoa(v.Len()) + ":" + v.String()))
+	case reflect.Ptr:
+		if v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		if cycle(h, v, path) {
+			return
+		}
+		writeValue(h, v.Elem(), path)
+		delete(path, v.Pointer())
+	case reflect.Interface:
+		if v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		h.Write([]byte(v.Elem().Type().String()))
+		writeValue(h, v.Elem(), path)
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		h.Write([]byte(strconv.Itoa(v.Len())))
+		// e.g. an []interface{} that contains itself
+		if v.Kind() == reflect.Slice && v.Len() > 0 {
+			if cycle(h, v, path) {
+				return
+			}
+			defer delete(path, v.Pointer())
+		}
+		for i := 0; i < v.Len(); i++ {
+			writeValue(h, v.Index(i), path)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			h.Write([]byte{0})
+			return
+		}
+		if cycle(h, v, path) {
+			return
+		}
+		defer delete(path, v.Pointer())
+		// map order is random, the entries' fingerprints are summed
+		var sum uint64
+		for _, key := range v.MapKeys() {
+			entry := fnv.New64a()
+			writeValue(entry, key, path)
+			writeValue(entry, v.MapIndex(key), path)
+			sum += entry.Sum64()
+		}
+		h.Write([]byte(strconv.Itoa(v.Len()) + ":" + strconv.FormatUint(sum, 16)))
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeValue(h, v.Field(i), path)
+		}
+	default:
+		// funcs, channels: only their identity
+		h.Write([]byte(strconv.FormatUint(uint64(v.Pointer()), 16)))
+	}
+}
+
 type MapStorage struct {
 	store map[string]interface{}
+	tracker
 }
 
 func (s *MapStorage) RawSetValue(key string, value interface{}) {
-	s.store[key] = value
+	if err := s.SetValue(key, value); err != nil {
+		j.J("Could not set value", err.Error())
+	}
 }
 
 func (s *MapStorage) RawGetValue(key string) interface{} {
-	return s.store[key]
+	v, err := s.GetValue(key)
+	if err != nil {
+		j.J("Could not get value", err.Error())
+	}
+	return v
+}
+
+// GetValue gets the value at path, the first step is a key in the storage
+func (s *MapStorage) GetValue(path string) (interface{}, error) {
+	s.read(firstKey(path))
+	// a plain key needn't be parsed, it may not even be a valid name
+	if v, ok := s.store[path]; ok {
+		return v, nil
+	}
+	if firstKey(path) == path {
+		return nil, &vtree.PathError{Path: path, Msg: "storage has no key " + path}
+	}
+	return getPath(reflect.ValueOf(s.store), path)
+}
+
+// SetValue sets the value at path, the first step is a key in the storage.
+// A key takes any value, a path into it must fit what's there
+func (s *MapStorage) SetValue(path string, value interface{}) error {
+	if _, ok := s.store[path]; ok || firstKey(path) == path {
+		s.store[path] = value
+		s.write(path)
+		return nil
+	}
+	key, err := setPath(reflect.ValueOf(s.store), path, value)
+	if err == nil {
+		s.write(key)
+	}
+	return err
 }
 
 func (s *MapStorage) MakeContext() *vtree.Context {
@@ -33,63 +334,142 @@ func (s *MapStorage) MakeContext() *vtree.Context {
 	return ctx
 }
 
+func (s *MapStorage) values() map[string]reflect.Value {
+	values := make(map[string]reflect.Value)
+	for k, v := range s.store {
+		values[k] = reflect.ValueOf(v)
+	}
+	return values
+}
+
+// Changes returns the keys that were written or changed since the last Commit
+func (s *MapStorage) Changes() []string {
+	return s.changes(s.values())
+}
+
+// Commit marks the current values as rendered
+func (s *MapStorage) Commit() {
+	s.commit(s.values())
+}
+
 func NewMapStorage() Storage {
 	return &MapStorage{store: make(map[string]interface{})}
 }
 
 type StructStorage struct {
 	Struct interface{}
+	tracker
 }
 
 // https://github.com/a8m/reflect-examples
 
 func (s *StructStorage) RawSetValue(key string, value interface{}) {
-	// return err?
-	// use resolve to handle errors?
-	// look at how json handles this
-	storage := reflect.ValueOf(s.Struct).Elem()
-	field := storage.FieldByName(key)
-
-	// ValType := reflect.TypeOf(val)
-	// FieldType := reflect.TypeOf(field)
-
-	ValVal := reflect.ValueOf(value)
-
-	// fmt.Printf("%s -> %v - %v\n", key, FieldType, ValType)
-	if !field.IsValid() || !field.CanSet() {
-		j.J("Could not RawSet field - not valid!", key)
+	if err := s.SetValue(key, value); err != nil {
+		j.J("Could not set value", err.Error())
 	}
-	field.Set(ValVal)
-	// switch ValType.Kind() {
-	// case reflect.String:
-	// 	field.Set(ValVal)
-	// case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-	// 	// tt := typ.Elem()
-	// 	field.Set(ValVal)
-	// }
 }
 
 func (s *StructStorage) RawGetValue(key string) interface{} {
-	storage := reflect.ValueOf(s.Struct).Elem()
-	field := storage.FieldByName(key)
+	v, err := s.GetValue(key)
+	if err != nil {
+		j.J("Could not get value", err.Error())
+	}
+	return v
+}
 
-	// Does this return the value of the field as interface{} ?
-	return field.Interface()
+// GetValue gets the value at path, the first step is a field of the struct
+func (s *StructStorage) GetValue(path string) (interface{}, error) {
+	s.read(firstKey(path))
+	return getPath(reflect.ValueOf(s.Struct), path)
+}
+
+// SetValue sets the value at path, the first step is a field of the struct
+func (s *StructStorage) SetValue(path string, value interface{}) error {
+	key, err := setPath(reflect.ValueOf(s.Struct), path, value)
+	if err == nil {
+		s.write(key)
+	}
+	return err
 }
 
 func (s *StructStorage) MakeContext() *vtree.Context {
 	ctx := &vtree.Context{}
-	t := reflect.TypeOf(s.Struct)
-	v := reflect.ValueOf(s.Struct)
-	if t.Kind() == reflect.Ptr {
-		v = v.Elem()
-		t = t.Elem()
-	}
+	// unexported fields can't be used
+	structFields(reflect.Indirect(reflect.ValueOf(s.Struct)), false, ctx.PushValue)
+	return ctx
+}
+
+// values returns the struct's fields, including unexported ones
+func (s *StructStorage) values() map[string]reflect.Value {
+	values := make(map[string]reflect.Value)
+	structFields(reflect.Indirect(reflect.ValueOf(s.Struct)), true, func(name string, value reflect.Value) {
+		values[name] = value
+	})
+	return values
+}
+
+var componentType = reflect.TypeOf((*Component)(nil)).Elem()
 
-	for i := 0; i < t.NumField(); i++ {
-		ctx.PushValue(t.Field(i).Name, v.Field(i))
+/*
+ * structFields calls f for the fields of struct v, and the fields promoted
+ * from the (exported) structs it embeds, like Go finds them: a field hides
+ * deeper fields with the same name, fields at the same depth hide each
+ * other. An embedded component, like BaseComponent, is the component's
+ * plumbing and left out.
+ */
+func structFields(v reflect.Value, unexported bool, f func(name string, value reflect.Value)) {
+	hidden := make(map[string]bool)
+	expanded := make(map[reflect.Type]bool)
+	expanded[v.Type()] = true
+	for level := []reflect.Value{v}; len(level) > 0; {
+		var names []string
+		found := make(map[string][]reflect.Value)
+		var next []reflect.Value
+		for _, s := range level {
+			t := s.Type()
+			for i := 0; i < t.NumField(); i++ {
+				field := t.Field(i)
+				exported := field.PkgPath == ""
+				if field.Anonymous {
+					ptr := field.Type
+					if ptr.Kind() != reflect.Ptr {
+						ptr = reflect.PtrTo(ptr)
+					}
+					if !exported || ptr.Implements(componentType) {
+						continue
+					}
+					if e := reflect.Indirect(s.Field(i)); e.Kind() == reflect.Struct && !expanded[e.Type()] {
+						expanded[e.Type()] = true
+						next = append(next, e)
+					}
+				}
+				if !exported && !unexported {
+					continue
+				}
+				if found[field.Name] == nil {
+					names = append(names, field.Name)
+				}
+				found[field.Name] = append(found[field.Name], s.Field(i))
+			}
+		}
+		for _, name := range names {
+			if !hidden[name] && len(found[name]) == 1 {
+				f(name, found[name][0])
+			}
+			hidden[name] = true
+		}
+		level = next
 	}
-	return ctx
+}
+
+// Changes returns the fields that were written or changed since the last Commit
+func (s *StructStorage) Changes() []string {
+	return s.changes(s.values())
+}
+
+// Commit marks the current values as rendered
+func (s *StructStorage) Commit() {
+	s.commit(s.values())
 }
 
 func NewStructStorage(struc interface{}) Storage {
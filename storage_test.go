@@ -1,5 +1,12 @@
 package gadget
 
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-gadget/gadget/vtree"
+)
+
 // taken from vtree.context_test - rewrite XXX
 // func TestContextCreate(t *testing.T) {
 // 	data := struct {
@@ -15,3 +22,238 @@ package gadget
 // 	AssertValueString(t, ctx, "Foo", "Hello World")
 // 	AssertValueInt(t, ctx, "Bar", 42)
 // }
+
+type TrackedNode struct {
+	Label string
+	Next  *TrackedNode
+}
+
+type TrackedData struct {
+	GeneratedComponent
+	Count int
+	Todos []Todo
+	Node  *TrackedNode
+	Tags  map[string]bool
+}
+
+func TestStorageChanges(t *testing.T) {
+	TestCases := map[string]struct {
+		Change   func(d *TrackedData, s Storage)
+		Expected string
+	}{
+		"Nothing":         {func(d *TrackedData, s Storage) {}, ""},
+		"Written":         {func(d *TrackedData, s Storage) { s.RawSetValue("Count", 1) }, "Count"},
+		"Written, equal":  {func(d *TrackedData, s Storage) { s.RawSetValue("Count", 0) }, "Count"},
+		"Direct":          {func(d *TrackedData, s Storage) { d.Count = 2 }, "Count"},
+		"In place":        {func(d *TrackedData, s Storage) { d.Todos[0].Done = true }, "Todos"},
+		"Through pointer": {func(d *TrackedData, s Storage) { d.Node.Next.Label = "c" }, "Node"},
+		"Map":             {func(d *TrackedData, s Storage) { d.Tags["b"] = true }, "Tags"},
+		"Several": {func(d *TrackedData, s Storage) {
+			d.Todos = append(d.Todos, Todo{2, "test", false})
+			s.RawSetValue("Count", 3)
+		}, "Count,Todos"},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			d := &TrackedData{
+				Todos: []Todo{{1, "write", false}},
+				Node:  &TrackedNode{"a", &TrackedNode{Label: "b"}},
+				Tags:  map[string]bool{"a": true},
+			}
+			// a cycle must not hang
+			d.Node.Next.Next = d.Node
+			s := NewStructStorage(d)
+			d.SetupStorage(s)
+			s.(TrackingStorage).Commit()
+
+			TestCase.Change(d, s)
+			if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != TestCase.Expected {
+				t.Errorf("Expected changes %q, got %q", TestCase.Expected, r)
+			}
+		})
+	}
+
+	t.Run("Test map storage", func(t *testing.T) {
+		s := NewMapStorage()
+		s.RawSetValue("a", []int{1})
+		if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != "a" {
+			t.Errorf("Expected new keys to be changed, got %q", r)
+		}
+		s.(TrackingStorage).Commit()
+		if r := s.(TrackingStorage).Changes(); len(r) != 0 {
+			t.Errorf("Expected no changes after commit, got %v", r)
+		}
+		s.RawGetValue("a").([]int)[0] = 2
+		if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != "a" {
+			t.Errorf("Expected the changed slice to be found, got %q", r)
+		}
+	})
+
+	t.Run("Test map cycle", func(t *testing.T) {
+		s := NewMapStorage()
+		m := map[string]interface{}{"a": 1}
+		m["self"] = m
+		l := []interface{}{1}
+		l[0] = l
+		s.RawSetValue("m", m)
+		s.RawSetValue("l", l)
+		s.(TrackingStorage).Commit()
+		if r := s.(TrackingStorage).Changes(); len(r) != 0 {
+			t.Errorf("Expected no changes after commit, got %v", r)
+		}
+		m["a"] = 2
+		if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != "m" {
+			t.Errorf("Expected the changed map to be found, got %q", r)
+		}
+	})
+}
+
+type TrackedAddress struct {
+	City   string
+	Street string
+}
+
+type EmbeddingData struct {
+	GeneratedComponent
+	TrackedAddress
+	*TrackedNode
+	Street string
+}
+
+func TestStorageEmbedded(t *testing.T) {
+	t.Run("Test context", func(t *testing.T) {
+		d := &EmbeddingData{TrackedAddress: TrackedAddress{"Paris", "inner"}, Street: "outer"}
+		ctx := NewStructStorage(d).MakeContext()
+
+		if r := ctx.Get("City"); r == vtree.NotFound || r.Interface() != "Paris" {
+			t.Errorf("Expected the promoted field, got %v", r)
+		}
+		if r := ctx.Get("Street"); r == vtree.NotFound || r.Interface() != "outer" {
+			t.Errorf("Expected the outer field to hide the promoted one, got %v", r)
+		}
+		for _, name := range []string{"State", "Storage", "GeneratedComponent", "Label"} {
+			if r := ctx.Get(name); r != vtree.NotFound {
+				t.Errorf("Didn't expect %s in the context", name)
+			}
+		}
+	})
+
+	t.Run("Test changes", func(t *testing.T) {
+		d := &EmbeddingData{}
+		s := NewStructStorage(d)
+		s.(TrackingStorage).Commit()
+
+		s.RawSetValue("City", "Paris")
+		if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != "City,TrackedAddress" {
+			t.Errorf("Expected the promoted field to be changed, got %q", r)
+		}
+		s.(TrackingStorage).Commit()
+		d.City = "Rome"
+		if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != "City,TrackedAddress" {
+			t.Errorf("Expected the changed promoted field to be found, got %q", r)
+		}
+	})
+
+	t.Run("Test rendered", func(t *testing.T) {
+		g := NewGadget(NewTestBridge())
+		component := g.NewComponent(&ComponentFactory{
+			Name: "embedding",
+			Builder: func() Component {
+				d := &EmbeddingData{}
+				d.gTemplate = `<p g-value="City"></p>`
+				d.SetupStorage(NewStructStorage(d))
+				return d
+			},
+		})
+		g.Mount(component)
+		g.SingleLoop()
+
+		for _, path := range []string{"City", "TrackedAddress.City"} {
+			component.SetValue(path, path)
+			g.SingleLoop()
+			if r := component.State.ExecutedTree.ToString(); r != "<p>"+path+"</p>" {
+				t.Errorf("Expected the write to %s to be rendered, got %s", path, r)
+			}
+		}
+	})
+}
+
+func TestStoragePaths(t *testing.T) {
+	t.Run("Test struct storage", func(t *testing.T) {
+		d := &TrackedData{Todos: []Todo{{1, "write", false}}, Tags: map[string]bool{}}
+		s := NewStructStorage(d)
+		d.SetupStorage(s)
+		s.(TrackingStorage).Commit()
+
+		if err := s.SetValue("Todos[0].Title", "test"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if err := s.SetValue(`Tags["go"]`, true); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if v, err := s.GetValue("Todos[0].Title"); err != nil || v != "test" {
+			t.Errorf("Expected test, got %v (%v)", v, err)
+		}
+		if !d.Tags["go"] {
+			t.Errorf("Expected the map to be set")
+		}
+		if r := strings.Join(s.(TrackingStorage).Changes(), ","); r != "Tags,Todos" {
+			t.Errorf("Expected the paths' fields to be changed, got %q", r)
+		}
+	})
+
+	t.Run("Test map storage", func(t *testing.T) {
+		s := NewMapStorage()
+		s.RawSetValue("todo", Todo{1, "write", false})
+
+		// the struct in the map is copied, changed and stored again
+		if err := s.SetValue("todo.Title", "test"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if v := s.RawGetValue("todo.Title"); v != "test" {
+			t.Errorf("Expected test, got %v", v)
+		}
+		if v := s.RawGetValue("missing"); v != nil {
+			t.Errorf("Expected nil for a missing key, got %v", v)
+		}
+		if _, err := s.GetValue("missing"); err == nil || err.Error() != `storage has no key missing (in path "missing")` {
+			t.Errorf("Expected an error for a missing key, got %v", err)
+		}
+	})
+
+	t.Run("Test map storage is untyped", func(t *testing.T) {
+		s := NewMapStorage()
+		s.RawSetValue("count", 1)
+		if err := s.SetValue("count", "many"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if v := s.RawGetValue("count"); v != "many" {
+			t.Errorf("Expected many, got %#v", v)
+		}
+	})
+
+	TestErrors := map[string]struct {
+		Path  string
+		Value interface{}
+		Err   string
+	}{
+		"Unknown field": {"Nope", 1, `gadget.TrackedData has no field Nope (in path "Nope")`},
+		"Wrong type":    {"Count", []int{1}, `can't use []int as int (in path "Count")`},
+		"Conversion":    {"Count", "many", `Count: can't convert "many" to int: strconv.ParseInt: parsing "many": invalid syntax`},
+		"Nil pointer":   {"Node.Label", "x", `can't set Label of nil (in path "Node.Label")`},
+	}
+
+	for Name, TestCase := range TestErrors {
+		t.Run(Name, func(t *testing.T) {
+			d := &TrackedData{}
+			s := NewStructStorage(d)
+			err := s.SetValue(TestCase.Path, TestCase.Value)
+			if err == nil || err.Error() != TestCase.Err {
+				t.Errorf("Expected error %q, got %v", TestCase.Err, err)
+			}
+			// RawSetValue doesn't panic
+			s.RawSetValue(TestCase.Path, TestCase.Value)
+		})
+	}
+}
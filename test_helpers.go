@@ -31,7 +31,8 @@ type TestBridge struct {
 	AddCount             uint16
 	DeleteCount          uint16
 	InsertBeforeCount    uint16
-	SyncStateCount       uint16
+	Events               vtree.EventDispatcher
+	Dispatched           []vtree.EventDispatch
 }
 
 func NewTestBridge() *TestBridge {
@@ -44,7 +45,7 @@ func (t *TestBridge) Reset() {
 	t.AddCount = 0
 	t.DeleteCount = 0
 	t.InsertBeforeCount = 0
-	t.SyncStateCount = 0
+	t.Dispatched = nil
 }
 
 func (t *TestBridge) GetLocation() string {
@@ -60,6 +61,7 @@ func (t *TestBridge) AttributeChange(Target vtree.Node, Adds, Deletes, Updates v
 }
 func (t *TestBridge) Replace(old vtree.Node, new vtree.Node) error {
 	t.ReplaceCount++
+	t.Events.Forget(old)
 	return nil
 }
 func (t *TestBridge) Add(el vtree.Node, parent vtree.Node) error {
@@ -68,14 +70,20 @@ func (t *TestBridge) Add(el vtree.Node, parent vtree.Node) error {
 }
 func (t *TestBridge) Delete(el vtree.Node) error {
 	t.DeleteCount++
+	t.Events.Forget(el)
 	return nil
 }
 func (t *TestBridge) InsertBefore(before vtree.Node, after vtree.Node) error {
 	t.InsertBeforeCount++
 	return nil
 }
-func (t *TestBridge) SyncState(from vtree.Node) {
-	t.SyncStateCount++
+
+// TriggerEvent simulates an event on el, applying modifiers like the DOM
+// bridge would. What was dispatched is recorded in Dispatched
+func (t *TestBridge) TriggerEvent(el *vtree.Element, ev *vtree.Event) []vtree.EventDispatch {
+	dispatches := t.Events.Dispatch(el, ev, nil)
+	t.Dispatched = append(t.Dispatched, dispatches...)
+	return dispatches
 }
 
 func FlattenComponents(base *ComponentInstance) *vtree.Element {
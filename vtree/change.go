@@ -2,7 +2,7 @@ package vtree
 
 /*
  * Subject is the subject of changes, e.g. a DOM
- * It's broader than that now - it syncs state, gets location,
+ * It's broader than that now - it dispatches events, gets location,
  * basically the bridge to the other side
  */
 type Subject interface {
@@ -11,7 +11,6 @@ type Subject interface {
 	Add(el Node, parent Node) error
 	Delete(el Node) error
 	InsertBefore(before Node, after Node) error
-	SyncState(from Node)
 	GetLocation() string
 	SetLocation(string)
 }
@@ -48,7 +47,8 @@ type ReplaceChange struct {
 	New Node
 }
 
-// MoveBeforeChange means `Before` must be inserted before `Node`
+// MoveBeforeChange means `Before` must be inserted before `Node`. If
+// `Node` is nil, `Before` must be moved to the end of its parent
 type MoveBeforeChange struct {
 	Node   Node // XXX Rename to After
 	Before Node
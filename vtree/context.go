@@ -2,6 +2,7 @@ package vtree
 
 import (
 	"reflect"
+	"strings"
 )
 
 /*
@@ -40,6 +41,12 @@ func (c *Context) Push(name string, value interface{}) {
 	c.PushValue(name, reflect.ValueOf(value))
 }
 
+// Copy returns a copy of the context, that isn't affected by pushing or
+// popping on the original
+func (c *Context) Copy() *Context {
+	return &Context{Variables: append([]Variable(nil), c.Variables...)}
+}
+
 func (c *Context) Mark() int {
 	return len(c.Variables)
 }
@@ -48,11 +55,34 @@ func (c *Context) Pop(mark int) {
 	c.Variables = c.Variables[0:mark]
 }
 
+// Get returns the value of a variable. A name that isn't a variable is
+// tried as a path, e.g. Address.City (see GetPath)
 func (c *Context) Get(name string) reflect.Value {
 	for i := len(c.Variables) - 1; i >= 0; i-- {
 		if c.Variables[i].Name == name {
 			return c.Variables[i].Value
 		}
 	}
+	if strings.ContainsAny(name, ".[") {
+		if v, err := c.GetPath(name); err == nil {
+			return v
+		}
+	}
 	return NotFound
 }
+
+// GetPath resolves a path, its first step is a variable
+func (c *Context) GetPath(path string) (reflect.Value, error) {
+	p, err := ParsePath(path)
+	if err != nil {
+		return NotFound, err
+	}
+	if p[0].Index {
+		return NotFound, p.error("a path must start with a name")
+	}
+	v := c.Get(p[0].Name)
+	if v == NotFound {
+		return NotFound, p.error("undefined variable %s", p[0].Name)
+	}
+	return p.get(v, p[1:])
+}
@@ -75,3 +75,24 @@ func TestPushPop(t *testing.T) {
 
 	AssertValueInt(t, ctx, "Foo", 123)
 }
+
+func TestContextPath(t *testing.T) {
+	type Address struct {
+		City string
+	}
+	ctx := &Context{}
+	ctx.Push("user", struct {
+		Address *Address
+		Tags    []string
+	}{&Address{"Utrecht"}, []string{"go"}})
+
+	AssertValueString(t, ctx, "user.Address.City", "Utrecht")
+	AssertValueString(t, ctx, "user.Tags[0]", "go")
+
+	if v := ctx.Get("user.Nope"); v != NotFound {
+		t.Errorf("Expected NotFound, got %v", v)
+	}
+	if _, err := ctx.GetPath("user.Tags[1]"); err == nil || err.Error() != `index 1 out of range (length 1) (in path "user.Tags[1]")` {
+		t.Errorf("Didn't get expected error, got %v", err)
+	}
+}
@@ -54,86 +54,118 @@ func Diff(el Node, other Node) ChangeSet {
 
 func (one NodeList) Diff(parent *Element, other NodeList) ChangeSet {
 	// perhaps *Element diff is just this on a single-element array
-
-	// loop over other - this is the order we want. Try to
-	// find the elements
 	//
-	// [] -> [1]
-	// [1, 2] -> [2, 1]
-	//  find last node -> 1, work backwards and insertbefore
-	// insertBefore and appendChild both remove from current
-	// position. But append adds at the end which is problematic
-
-	// find nodes to remove
-	// find nodes to add
-	// check if order is correct. If not, find last node
-	// and insetBefore to the front
-
-	// perhaps we need a map[ElementID]*Element (but doesn't keep order
+	// 1. remove nodes that are no longer present
+	// 2. diff nodes that are in both lists
+	// 3. find the longest sequence of retained nodes that is already in
+	//    the right order. These nodes stay where they are
+	// 4. walk backwards over the new list; add new nodes and move the
+	//    remaining retained nodes before the node that should follow them
+	//
+	// When walking backwards, the node that follows is always already in
+	// place. AddChange appends at the end, which is also where the last
+	// node belongs.
 
 	changeSet := make(ChangeSet, 0)
 
-	oldElements := make(map[ElementID]Node)
+	oldPositions := make(map[ElementID]int)
 	newElements := make(map[ElementID]Node)
 
-	for _, el := range one {
-		oldElements[el.GetID()] = el
+	for i, el := range one {
+		oldPositions[el.GetID()] = i
 	}
 
 	for _, el := range other {
 		newElements[el.GetID()] = el
 	}
 
-	orderChanged := false
-
 	// Elements to delete
 	for _, el := range one {
 		if _, exists := newElements[el.GetID()]; !exists {
 			changeSet = append(changeSet,
 				&DeleteChange{el})
-			// removing doesn't change order, but its easier to assume it does
-			orderChanged = true
 		}
 	}
 
-	// Elements to add
+	// Elements that were in both may have changed. Keep track of their
+	// old position, in the new order
+	var retained []int
 	for _, el := range other {
-		if _, exists := oldElements[el.GetID()]; !exists {
-			changeSet = append(changeSet,
-				&AddChange{Parent: parent, Node: el})
-			// adding may change order
-			orderChanged = true
-		} else {
-			extra := Diff(oldElements[el.GetID()], el)
+		if pos, exists := oldPositions[el.GetID()]; exists {
+			extra := Diff(one[pos], el)
 			if extra != nil {
 				changeSet = append(changeSet, extra...)
 			}
-			// elements that were in both may have changed
-			// check change el
+			retained = append(retained, pos)
 		}
 	}
 
-	// check order
-	if !orderChanged {
-		// order didn't change through add/del, but can still be
-		// different. Old/New must be same size
-		for pos, el := range other {
-			if el.GetID() != one[pos].GetID() {
-				orderChanged = true
-				break
-			}
-		}
+	stable := make(map[int]bool)
+	for _, pos := range LongestIncreasingSubsequence(retained) {
+		stable[retained[pos]] = true
 	}
 
-	if orderChanged && len(other) > 1 {
-		last := other[len(other)-1]
+	var next Node
+	for i := len(other) - 1; i >= 0; i-- {
+		el := other[i]
+		pos, exists := oldPositions[el.GetID()]
 
-		for i := len(other) - 2; i >= 0; i-- {
+		if !exists {
+			changeSet = append(changeSet,
+				&AddChange{Parent: parent, Node: el})
+			if next != nil {
+				changeSet = append(changeSet,
+					&MoveBeforeChange{Node: next, Before: el})
+			}
+		} else if !stable[pos] {
+			// a nil Node means: move to the end
 			changeSet = append(changeSet,
-				&MoveBeforeChange{Node: last, Before: other[i]})
-			last = other[i]
+				&MoveBeforeChange{Node: next, Before: el})
 		}
+		next = el
 	}
 
 	return changeSet
 }
+
+// LongestIncreasingSubsequence returns the positions in seq of a longest
+// strictly increasing subsequence. If there are several, the one ending
+// with the rightmost elements is preferred.
+func LongestIncreasingSubsequence(seq []int) []int {
+	// tails[l] is the position of the smallest tail of an increasing
+	// subsequence of length l+1, prev links each position to its predecessor
+	tails := make([]int, 0, len(seq))
+	prev := make([]int, len(seq))
+
+	for i, v := range seq {
+		// binary search for the first tail >= v
+		lo, hi := 0, len(tails)
+		for lo < hi {
+			mid := (lo + hi) / 2
+			if seq[tails[mid]] < v {
+				lo = mid + 1
+			} else {
+				hi = mid
+			}
+		}
+		if lo > 0 {
+			prev[i] = tails[lo-1]
+		} else {
+			prev[i] = -1
+		}
+		if lo == len(tails) {
+			tails = append(tails, i)
+		} else {
+			tails[lo] = i
+		}
+	}
+
+	result := make([]int, len(tails))
+	if len(tails) == 0 {
+		return result
+	}
+	for i, pos := len(tails)-1, tails[len(tails)-1]; i >= 0; i, pos = i-1, prev[pos] {
+		result[i] = pos
+	}
+	return result
+}
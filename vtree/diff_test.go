@@ -1,6 +1,10 @@
 package vtree
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strconv"
 	"testing"
 )
 
@@ -341,12 +345,11 @@ func TestListManyChanges(t *testing.T) {
 	}
 
 	changes := one.Diff(nil, other)
-	// 1 Delete, 1 Add, 2 reorders
-	AssertChangeCount(t, changes, 4)
+	// 1 Delete, 1 Add, 1 reorder: 1 stays in place, 2 moves before it
+	AssertChangeCount(t, changes, 3)
 	AssertDeleteChange(t, changes[0], "3")
 	AssertAddChange(t, changes[1], "5")
-	AssertMoveBeforeChange(t, changes[2], "1", "5")
-	AssertMoveBeforeChange(t, changes[3], "2", "1")
+	AssertMoveBeforeChange(t, changes[2], "2", "1")
 }
 
 func TestNested(t *testing.T) {
@@ -434,3 +437,145 @@ func TestReplaceFromText(t *testing.T) {
 	AssertDeleteChange(t, changes[0], one.Children[0].GetID())
 	AssertAddChange(t, changes[1], "2")
 }
+
+func TestLongestIncreasingSubsequence(t *testing.T) {
+	TestCases := []struct {
+		Seq      []int
+		Expected []int
+	}{
+		{[]int{}, []int{}},
+		{[]int{0, 1, 2}, []int{0, 1, 2}},
+		{[]int{2, 1, 0}, []int{2}},
+		{[]int{1, 0}, []int{1}},
+		{[]int{3, 0, 1, 2}, []int{1, 2, 3}},
+		{[]int{0, 4, 1, 2, 5, 3}, []int{0, 2, 3, 5}},
+	}
+
+	for _, TestCase := range TestCases {
+		t.Run(fmt.Sprint(TestCase.Seq), func(t *testing.T) {
+			if r := LongestIncreasingSubsequence(TestCase.Seq); !reflect.DeepEqual(r, TestCase.Expected) {
+				t.Errorf("Expected %v, got %v", TestCase.Expected, r)
+			}
+		})
+	}
+}
+
+// listSubject applies changes on a flat list of nodes, to verify a
+// ChangeSet actually results in the new order
+type listSubject struct {
+	DummyBridge
+	nodes []ElementID
+	moves int
+}
+
+func (l *listSubject) position(id ElementID) int {
+	for i, n := range l.nodes {
+		if n == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *listSubject) remove(id ElementID) {
+	pos := l.position(id)
+	l.nodes = append(l.nodes[:pos], l.nodes[pos+1:]...)
+}
+
+func (l *listSubject) Add(n Node, parent Node) error {
+	l.nodes = append(l.nodes, n.GetID())
+	return nil
+}
+
+func (l *listSubject) Delete(n Node) error {
+	l.remove(n.GetID())
+	return nil
+}
+
+func (l *listSubject) InsertBefore(before Node, after Node) error {
+	l.moves++
+	l.remove(before.GetID())
+	if after == nil {
+		l.nodes = append(l.nodes, before.GetID())
+		return nil
+	}
+	pos := l.position(after.GetID())
+	l.nodes = append(l.nodes[:pos], append([]ElementID{before.GetID()}, l.nodes[pos:]...)...)
+	return nil
+}
+
+func makeList(ids ...int) NodeList {
+	var list NodeList
+	for _, id := range ids {
+		list = append(list, El("li").SetID(ElementID(strconv.Itoa(id))))
+	}
+	return list
+}
+
+func AssertListDiffApplies(t *testing.T, one, other NodeList) *listSubject {
+	t.Helper()
+
+	subject := &listSubject{nodes: []ElementID{}}
+	for _, n := range one {
+		subject.nodes = append(subject.nodes, n.GetID())
+	}
+	one.Diff(nil, other).ApplyChanges(subject)
+
+	expected := []ElementID{}
+	for _, n := range other {
+		expected = append(expected, n.GetID())
+	}
+	if !reflect.DeepEqual(subject.nodes, expected) {
+		t.Errorf("Expected order %v, got %v", expected, subject.nodes)
+	}
+	return subject
+}
+
+func TestListMinimalMoves(t *testing.T) {
+	TestCases := map[string]struct {
+		One, Other []int
+		Moves      int
+	}{
+		"Test unchanged":         {[]int{1, 2, 3}, []int{1, 2, 3}, 0},
+		"Test insert at head":    {[]int{1, 2, 3}, []int{0, 1, 2, 3}, 1},
+		"Test insert in middle":  {[]int{1, 2, 3}, []int{1, 9, 2, 3}, 1},
+		"Test append":            {[]int{1, 2, 3}, []int{1, 2, 3, 4}, 0},
+		"Test remove":            {[]int{1, 2, 3}, []int{1, 3}, 0},
+		"Test move first to end": {[]int{1, 2, 3, 4}, []int{2, 3, 4, 1}, 1},
+		"Test move last to head": {[]int{1, 2, 3, 4}, []int{4, 1, 2, 3}, 1},
+		"Test swap two":          {[]int{1, 2, 3, 4, 5}, []int{1, 4, 3, 2, 5}, 2},
+		"Test reverse":           {[]int{1, 2, 3, 4}, []int{4, 3, 2, 1}, 3},
+		"Test mixed":             {[]int{1, 2, 3, 4, 5}, []int{6, 5, 1, 3, 7, 2}, 4},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			subject := AssertListDiffApplies(t, makeList(TestCase.One...), makeList(TestCase.Other...))
+			if subject.moves != TestCase.Moves {
+				t.Errorf("Expected %d moves, got %d", TestCase.Moves, subject.moves)
+			}
+		})
+	}
+
+	t.Run("Test random permutations", func(t *testing.T) {
+		rnd := rand.New(rand.NewSource(42))
+		for i := 0; i < 200; i++ {
+			one := rnd.Perm(rnd.Intn(12))
+			other := rnd.Perm(rnd.Intn(12))
+			AssertListDiffApplies(t, makeList(one...), makeList(other...))
+		}
+	})
+
+	t.Run("Test insert at head of large list", func(t *testing.T) {
+		var one []int
+		for i := 1; i <= 2000; i++ {
+			one = append(one, i)
+		}
+		changes := makeList(one...).Diff(nil, makeList(append([]int{0}, one...)...))
+
+		// the Add and a single move
+		AssertChangeCount(t, changes, 2)
+		AssertAddChange(t, changes[0], "0")
+		AssertMoveBeforeChange(t, changes[1], "0", "1")
+	})
+}
@@ -1,6 +1,8 @@
 package vtree
 
 type DummyBridge struct {
+	Events     EventDispatcher
+	Dispatched []EventDispatch
 }
 
 type BridgeBuilder func() Subject
@@ -16,8 +18,6 @@ func init() {
 	Builder = NewDummyBridge
 }
 
-func (b *DummyBridge) SyncState(From Node) {}
-
 func (b *DummyBridge) GetLocation() string {
 	return "/"
 }
@@ -31,6 +31,7 @@ func (b *DummyBridge) AttributeChange(Target Node, Adds, Deletes, Updates Attrib
 }
 
 func (b *DummyBridge) Replace(old Node, new Node) error {
+	b.Events.Forget(old)
 	return nil
 }
 
@@ -39,9 +40,18 @@ func (b *DummyBridge) Add(n Node, parent Node) error {
 }
 
 func (b *DummyBridge) Delete(el Node) error {
+	b.Events.Forget(el)
 	return nil
 }
 
 func (b *DummyBridge) InsertBefore(before Node, after Node) error {
 	return nil
 }
+
+// TriggerEvent simulates an event on el, applying modifiers like the DOM
+// bridge would. What was dispatched is recorded in Dispatched
+func (b *DummyBridge) TriggerEvent(el *Element, ev *Event) []EventDispatch {
+	dispatches := b.Events.Dispatch(el, ev, nil)
+	b.Dispatched = append(b.Dispatched, dispatches...)
+	return dispatches
+}
@@ -1,8 +1,8 @@
 package vtree
 
 import (
-	"strings"
 	"syscall/js"
+	"unicode/utf16"
 
 	"github.com/go-gadget/gadget/j"
 )
@@ -15,9 +15,17 @@ func init() {
 }
 
 type DomBridge struct {
-	Doc   js.Value
-	Root  js.Value
-	Nodes map[ElementID]js.Value
+	Doc    js.Value
+	Root   js.Value
+	Nodes  map[ElementID]js.Value
+	Events EventDispatcher
+	// Hydrating is set while server-rendered markup is being attached to,
+	// see Hydrate
+	Hydrating bool
+	// ReportMismatch is called for markup that couldn't be hydrated
+	ReportMismatch func(error)
+	// elements created while hydrating, there's no markup below these
+	created map[ElementID]bool
 }
 
 func NewDomBridge() Subject {
@@ -30,62 +38,287 @@ func NewDomBridge() Subject {
 	b.Doc = doc
 	b.Root = root
 	b.Nodes = make(map[ElementID]js.Value)
+	// markup with markers was rendered by the server
+	if marked := root.Call("querySelector", "["+MarkerAttribute+"]"); marked.Type() == js.TypeObject {
+		b.Hydrating = true
+		b.created = make(map[ElementID]bool)
+	}
+	b.ReportMismatch = func(err error) {
+		j.J(err.Error())
+	}
 	return b
 }
 
+// jsNode is a browser DOM node, for Hydrate
+type jsNode struct {
+	js.Value
+}
+
+func (n jsNode) NodeType() int {
+	return n.Get("nodeType").Int()
+}
+
+func (n jsNode) TagName() string {
+	return n.Get("tagName").String()
+}
+
+func (n jsNode) Attribute(name string) (string, bool) {
+	if !n.Call("hasAttribute", name).Bool() {
+		return "", false
+	}
+	return n.Call("getAttribute", name).String(), true
+}
+
+func (n jsNode) NodeValue() string {
+	return n.Get("nodeValue").String()
+}
+
+func (n jsNode) ChildNodes() []DOMNode {
+	children := n.Get("childNodes")
+	res := make([]DOMNode, children.Length())
+	for i := range res {
+		res[i] = jsNode{children.Index(i)}
+	}
+	return res
+}
+
+func (n jsNode) InsertText(text string, before DOMNode) DOMNode {
+	t := n.Get("ownerDocument").Call("createTextNode", text)
+	if before == nil {
+		n.Call("appendChild", t)
+	} else {
+		n.Call("insertBefore", t, before.(jsNode).Value)
+	}
+	return jsNode{t}
+}
+
+func (n jsNode) SplitText(child DOMNode, offset int) DOMNode {
+	// the browser counts UTF-16 code units
+	units := len(utf16.Encode([]rune(child.NodeValue()[:offset])))
+	return jsNode{child.(jsNode).Call("splitText", units)}
+}
+
+// EndHydration is called by gadget after the first loop, everything is
+// created as usual from then on
+func (b *DomBridge) EndHydration() {
+	b.Hydrating = false
+	b.created = nil
+}
+
+// hydrate attaches n to the markup in p. If that fails, the markup is
+// removed so n can be created in stead
+func (b *DomBridge) hydrate(n Node, p js.Value) bool {
+	nodes, err := Hydrate(n, jsNode{p})
+	if err != nil {
+		b.ReportMismatch(err)
+		for p.Get("firstChild").Type() == js.TypeObject {
+			p.Call("removeChild", p.Get("firstChild"))
+		}
+		return false
+	}
+	for id, d := range nodes {
+		b.Nodes[id] = d.(jsNode).Value
+	}
+	b.attach(n)
+	return true
+}
+
+// attach sets the properties and listeners of a hydrated tree, these
+// aren't part of the markup
+func (b *DomBridge) attach(n Node) {
+	el, ok := n.(*Element)
+	if !ok {
+		return
+	}
+	if !el.IsFragment() {
+		e := b.Nodes[el.GetID()]
+		for attr, value := range el.Attributes {
+			setAttribute(e, attr, value)
+		}
+		b.HandleSpecialAttributes(el, el.Attributes)
+	}
+	for _, c := range el.Children {
+		b.attach(c)
+	}
+}
+
 func (b *DomBridge) createElement(node Node) js.Value {
 
 	el := node.(*Element)
 
 	e := b.Doc.Call("createElement", el.Type)
 	b.Nodes[el.GetID()] = e
+	if b.Hydrating {
+		b.created[el.GetID()] = true
+	}
 	for attr, value := range el.Attributes {
-		if attr == "class" {
-			attr = "className"
-		}
-		e.Set(attr, value)
+		setAttribute(e, attr, value)
 	}
 
 	b.HandleSpecialAttributes(node, el.Attributes)
 	return e
 }
 
-func (b *DomBridge) SyncState(From Node) {
-	el := From.(*Element)
-	e := b.Nodes[From.GetID()]
+// booleanProperties are attributes that are reflected as boolean properties,
+// by property name. Their value doesn't matter (<input disabled> has ""),
+// and for e.g. checked the attribute only sets the default
+var booleanProperties = map[string]string{
+	"checked":   "checked",
+	"selected":  "selected",
+	"disabled":  "disabled",
+	"hidden":    "hidden",
+	"readonly":  "readOnly",
+	"required":  "required",
+	"multiple":  "multiple",
+	"autofocus": "autofocus",
+	"open":      "open",
+}
 
-	val := e.Get("value").String()
-	if el.Setter != nil {
-		el.Setter(val)
+// setAttribute sets an attribute through its property, since
+// e.g. an input's value attribute doesn't change the value after editing
+func setAttribute(e js.Value, attr string, value string) {
+	if attr == "class" {
+		attr = "className"
+	}
+	if property, ok := booleanProperties[attr]; ok {
+		e.Set(property, true)
+		return
 	}
+	e.Set(attr, value)
 }
 
-func (b *DomBridge) HandleSpecialAttribute(Target Node, action string, value string) {
-	// we need to register an onclick, install a handler
-	// and call something on a component. Just a attr/value and
-	// node/element isn't sufficnent, so we need to pre-handle things.
-	// Basically we need a func to call
+func removeAttribute(e js.Value, attr string) {
+	if property, ok := booleanProperties[attr]; ok {
+		e.Set(property, false)
+	}
+	e.Call("removeAttribute", attr)
+}
 
-	// if it has attributes it must be an element
-	el := Target.(*Element)
+// controlState reads the state of a form control
+func controlState(e js.Value) ControlState {
+	state := ControlState{}
+	if e.Type() != js.TypeObject {
+		return state
+	}
+	if v := e.Get("value"); v.Type() == js.TypeString {
+		state.Value = v.String()
+	}
+	if c := e.Get("checked"); c.Type() == js.TypeBoolean {
+		state.Checked = c.Bool()
+	}
+	if m := e.Get("multiple"); m.Type() == js.TypeBoolean && m.Bool() {
+		options := e.Get("selectedOptions")
+		for i := 0; i < options.Length(); i++ {
+			state.Values = append(state.Values, options.Index(i).Get("value").String())
+		}
+	}
+	return state
+}
+
+// listen installs a listener for event on Target's DOM node, dispatching
+// to all of Target's bindings for the event
+func (b *DomBridge) listen(Target *Element, event string) {
 	e := b.Nodes[Target.GetID()]
 
-	if action == "click" {
-		handler, ok := el.Handlers[value]
+	listener := func(jsEvent js.Value) {
+		ev := makeEvent(jsEvent)
+		ev.Type = event
+
+		// modifiers must be applied before the UserAction gets queued
+		b.Events.Dispatch(Target, ev, func(d EventDispatch) {
+			if d.PreventDefault {
+				jsEvent.Call("preventDefault")
+			}
+			if d.StopPropagation {
+				jsEvent.Call("stopPropagation")
+			}
+		})
+	}
 
-		if !ok {
-			return
+	e.Set("on"+event, jsHandler(listener))
+	j.J("on" + event + " set")
+}
+
+// HandleSpecialAttribute (re)installs the listener for an event attribute.
+// If no bindings for the event remain, the listener is removed
+func (b *DomBridge) HandleSpecialAttribute(Target Node, attr string, value string) {
+	b.HandleSpecialAttributes(Target, Attributes{attr: value})
+}
+
+// makeEvent copies the relevant properties of a DOM event
+func makeEvent(ev js.Value) *Event {
+	if ev.Type() != js.TypeObject {
+		return &Event{}
+	}
+	str := func(v js.Value, prop string) string {
+		if p := v.Get(prop); p.Type() == js.TypeString {
+			return p.String()
+		}
+		return ""
+	}
+	num := func(prop string) int {
+		if p := ev.Get(prop); p.Type() == js.TypeNumber {
+			return p.Int()
 		}
+		return 0
+	}
+	flag := func(v js.Value, prop string) bool {
+		if p := v.Get(prop); p.Type() == js.TypeBoolean {
+			return p.Bool()
+		}
+		return false
+	}
 
-		e.Set("onclick", jsHandler(handler))
-		j.J("onclick set to ", value)
+	event := &Event{
+		Type:     str(ev, "type"),
+		Key:      str(ev, "key"),
+		ClientX:  num("clientX"),
+		ClientY:  num("clientY"),
+		Button:   num("button"),
+		AltKey:   flag(ev, "altKey"),
+		CtrlKey:  flag(ev, "ctrlKey"),
+		ShiftKey: flag(ev, "shiftKey"),
+		MetaKey:  flag(ev, "metaKey"),
+		// AT_TARGET: the event happened on the element itself
+		Self: num("eventPhase") == 2,
 	}
+	if target := ev.Get("target"); target.Type() == js.TypeObject {
+		state := controlState(target)
+		event.Value, event.Checked, event.Values = state.Value, state.Checked, state.Values
+	}
+	return event
 }
 
 func (b *DomBridge) HandleSpecialAttributes(Target Node, attrs Attributes) {
-	for k, v := range attrs {
-		if strings.HasPrefix(k, "g-") {
-			b.HandleSpecialAttribute(Target, k[2:], v)
+	// we need to register an event handler, install a handler
+	// and call something on a component. Just a attr/value and
+	// node/element isn't sufficnent, so we need to pre-handle things.
+	// Basically we need a func to call
+
+	// if it has attributes it must be an element
+	el := Target.(*Element)
+
+	// Several attributes may bind the same event (e.g. @keydown.enter and
+	// @keydown.esc), they share a single listener
+	events := make(map[string]bool)
+	for k := range attrs {
+		if binding, ok := ParseEventAttribute(k); ok {
+			events[binding.Event] = false
+		} else if modifiers, ok := ParseModelAttribute(k); ok {
+			events[ModelEvent(el, modifiers)] = false
+		}
+	}
+	for _, binding := range el.EventBindings() {
+		if _, ok := events[binding.Event]; ok {
+			events[binding.Event] = true
+		}
+	}
+
+	for event, bound := range events {
+		if bound {
+			b.listen(el, event)
+		} else {
+			b.Nodes[Target.GetID()].Set("on"+event, js.Null())
 		}
 	}
 }
@@ -96,31 +329,19 @@ func (b *DomBridge) AttributeChange(Target Node, Adds, Deletes, Updates Attribut
 	// Is it likely that a g- attribute gets dynamically added (resulting in a change)?
 	b.HandleSpecialAttributes(Target, Adds)
 	for attr, value := range Adds {
-		// duplication with createElement
 		// skip g-*
-		if attr == "class" {
-			attr = "className"
-		}
-		e.Set(attr, value)
+		setAttribute(e, attr, value)
 	}
 
 	b.HandleSpecialAttributes(Target, Updates)
 	for attr, value := range Updates {
-		// duplication with createElement
 		// skip g-*
-		if attr == "class" {
-			attr = "className"
-		}
-		e.Set(attr, value)
+		setAttribute(e, attr, value)
 	}
 
-	for attr, _ := range Deletes {
-		// but here className won't work..?
-		if strings.HasPrefix(attr, "g-") {
-			// XXX Also: delete node -> cleanup
-			// b.ClearSpecialAttribute(e, attr, value)
-		}
-		e.Call("removeAttribute", attr)
+	b.HandleSpecialAttributes(Target, Deletes)
+	for attr := range Deletes {
+		removeAttribute(e, attr)
 	}
 	return nil
 }
@@ -136,6 +357,7 @@ func (b *DomBridge) Replace(old Node, new Node) error {
 		return nil
 	}
 	// replace == delete, add
+	b.Events.Forget(old)
 	oldE := b.Nodes[old.GetID()]
 	newE := b.createElement(new)
 	b.Nodes[new.GetID()] = newE
@@ -167,6 +389,12 @@ func (b *DomBridge) Add(n Node, parent Node) error {
 	// parent is 100% sure an element, can't be Text
 	p := b.getParent(parent)
 
+	// Trees are added to the root or to their component's element. Below
+	// an element that was just created there's no markup to attach to
+	if b.Hydrating && (parent == nil || !b.created[parent.GetID()]) && b.hydrate(n, p) {
+		return nil
+	}
+
 	t, ok := n.(*Text)
 	if ok {
 		e := b.Doc.Call("createTextNode", t.Text)
@@ -175,8 +403,28 @@ func (b *DomBridge) Add(n Node, parent Node) error {
 
 		return nil
 	}
+	if c, ok := n.(*Comment); ok {
+		e := b.Doc.Call("createComment", c.Text)
+		b.Nodes[c.GetID()] = e
+		p.Call("appendChild", e)
+
+		return nil
+	}
 	el := n.(*Element)
 
+	// A fragment has no node of its own, its children go into
+	// the parent. Registering the parent lets them find it
+	if el.IsFragment() {
+		b.Nodes[el.GetID()] = p
+		if b.Hydrating {
+			b.created[el.GetID()] = true
+		}
+		for _, c := range el.Children {
+			b.Add(c, el)
+		}
+		return nil
+	}
+
 	e := b.createElement(n)
 
 	p.Call("appendChild", e)
@@ -188,6 +436,14 @@ func (b *DomBridge) Add(n Node, parent Node) error {
 }
 
 func (b *DomBridge) Delete(el Node) error {
+	b.Events.Forget(el)
+	if f, ok := el.(*Element); ok && f.IsFragment() {
+		for _, c := range f.Children {
+			b.Delete(c)
+		}
+		delete(b.Nodes, el.GetID())
+		return nil
+	}
 	child := b.Nodes[el.GetID()]
 	p := child.Get("parentElement")
 
@@ -199,6 +455,12 @@ func (b *DomBridge) Delete(el Node) error {
 
 func (b *DomBridge) InsertBefore(before Node, after Node) error {
 	nBefore := b.Nodes[before.GetID()]
+	if after == nil {
+		// move to the end
+		p := nBefore.Get("parentElement")
+		p.Call("appendChild", nBefore)
+		return nil
+	}
 	nAfter := b.Nodes[after.GetID()]
 	p := nAfter.Get("parentElement")
 
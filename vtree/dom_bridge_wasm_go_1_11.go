@@ -4,9 +4,13 @@ package vtree
 
 import "syscall/js"
 
-func jsHandler(handler callable) js.Callback {
-	cb := func([]js.Value) {
-		handler()
+func jsHandler(handler func(js.Value)) js.Callback {
+	cb := func(args []js.Value) {
+		event := js.Undefined()
+		if len(args) > 0 {
+			event = args[0]
+		}
+		handler(event)
 	}
 
 	return js.NewCallback(cb)
@@ -4,9 +4,13 @@ package vtree
 
 import "syscall/js"
 
-func jsHandler(handler callable) js.Func {
-	cb := func(js.Value, []js.Value) interface{} {
-		handler()
+func jsHandler(handler func(js.Value)) js.Func {
+	cb := func(this js.Value, args []js.Value) interface{} {
+		event := js.Undefined()
+		if len(args) > 0 {
+			event = args[0]
+		}
+		handler(event)
 		return nil
 	}
 
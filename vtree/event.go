@@ -0,0 +1,301 @@
+package vtree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Event holds the payload of a (DOM) event, as far as it's relevant to
+// handlers. Fields that don't apply to the specific event are left empty.
+type Event struct {
+	Type string
+	// Keyboard events
+	Key string
+	// The value and checked state of the element the event happened on,
+	// e.g. an <input>. Values holds the selected options of a
+	// <select multiple>
+	Value   string
+	Checked bool
+	Values  []string
+	// Mouse events
+	ClientX int
+	ClientY int
+	Button  int
+	// Modifier keys
+	AltKey   bool
+	CtrlKey  bool
+	ShiftKey bool
+	MetaKey  bool
+	// Self is true if the event happened on the element itself, not on
+	// one of its children
+	Self bool
+	// Payload of a custom event emitted by a component
+	Payload interface{}
+}
+
+// An EventBinding binds a handler to an event through an attribute, e.g.
+// g-on:keydown.enter.prevent="save"
+type EventBinding struct {
+	Attr      string
+	Event     string
+	Modifiers []string
+}
+
+/*
+ * ParseEventAttribute checks if an attribute binds a handler to an event and
+ * if so, returns the binding. Supported are:
+ *
+ * g-on:<event>[.modifier...]="handler"
+ * @<event>[.modifier...]="handler"
+ * g-click="handler" (same as g-on:click)
+ *
+ * The modifiers aren't checked here, see Check.
+ */
+func ParseEventAttribute(attr string) (*EventBinding, bool) {
+	var spec string
+
+	switch {
+	case attr == "g-click":
+		spec = "click"
+	case strings.HasPrefix(attr, "g-on:"):
+		spec = attr[len("g-on:"):]
+	case strings.HasPrefix(attr, "@"):
+		spec = attr[1:]
+	default:
+		return nil, false
+	}
+
+	parts := strings.Split(spec, ".")
+	if parts[0] == "" {
+		return nil, false
+	}
+	return &EventBinding{Attr: attr, Event: parts[0], Modifiers: parts[1:]}, true
+}
+
+// ControlState returns the state of the form control the event happened on
+func (ev *Event) ControlState() ControlState {
+	return ControlState{Value: ev.Value, Checked: ev.Checked, Values: ev.Values}
+}
+
+// EventBindings returns the event bindings on an element, ordered by
+// attribute. A g-model binds to the event that signals its control changed.
+func (el *Element) EventBindings() []*EventBinding {
+	var bindings []*EventBinding
+
+	for attr := range el.Attributes {
+		if b, ok := ParseEventAttribute(attr); ok {
+			bindings = append(bindings, b)
+		} else if modifiers, ok := ParseModelAttribute(attr); ok {
+			bindings = append(bindings, &EventBinding{Attr: attr, Event: ModelEvent(el, modifiers)})
+		}
+	}
+	sort.Slice(bindings, func(i, j int) bool {
+		return bindings[i].Attr < bindings[j].Attr
+	})
+	return bindings
+}
+
+// Has checks if the binding has a specific modifier
+func (b *EventBinding) Has(modifier string) bool {
+	for _, m := range b.Modifiers {
+		if m == modifier {
+			return true
+		}
+	}
+	return false
+}
+
+// keyAliases maps key modifiers to KeyboardEvent.key values
+var keyAliases = map[string][]string{
+	"enter":  {"Enter"},
+	"tab":    {"Tab"},
+	"esc":    {"Escape", "Esc"},
+	"space":  {" ", "Spacebar"},
+	"up":     {"ArrowUp", "Up"},
+	"down":   {"ArrowDown", "Down"},
+	"left":   {"ArrowLeft", "Left"},
+	"right":  {"ArrowRight", "Right"},
+	"delete": {"Delete", "Backspace"},
+}
+
+// keyNames are other KeyboardEvent.key values (lowercased) that can be used
+// as key filter. A single character filters on that character
+var keyNames = map[string]bool{
+	"backspace": true, "escape": true, "insert": true, "home": true, "end": true,
+	"pageup": true, "pagedown": true, "arrowup": true, "arrowdown": true,
+	"arrowleft": true, "arrowright": true, "capslock": true, "contextmenu": true,
+	"f1": true, "f2": true, "f3": true, "f4": true, "f5": true, "f6": true,
+	"f7": true, "f8": true, "f9": true, "f10": true, "f11": true, "f12": true,
+}
+
+// keyEvents are the events key filters apply to
+var keyEvents = map[string]bool{"keydown": true, "keyup": true, "keypress": true}
+
+// EventModifiers are the modifiers that change how an event is handled.
+// Any other modifier is a key filter.
+var EventModifiers = []string{"prevent", "stop", "once", "self"}
+
+// SystemKeys are the modifier keys an event can be filtered on, for
+// mouse events as well
+var SystemKeys = []string{"ctrl", "alt", "shift", "meta"}
+
+func isEventModifier(modifier string) bool {
+	for _, m := range EventModifiers {
+		if m == modifier {
+			return true
+		}
+	}
+	return false
+}
+
+func isSystemKey(modifier string) bool {
+	for _, k := range SystemKeys {
+		if k == modifier {
+			return true
+		}
+	}
+	return false
+}
+
+func isKey(filter string) bool {
+	_, alias := keyAliases[filter]
+	return alias || keyNames[filter] || utf8.RuneCountInString(filter) == 1
+}
+
+// Check returns an error for modifiers that would never match, e.g. a typo
+// or a modifier gadget doesn't support (like capture). Key filters other
+// than system keys only apply to key events
+func (b *EventBinding) Check() error {
+	for _, m := range b.Modifiers {
+		switch {
+		case isEventModifier(m), isSystemKey(m):
+		case !isKey(m):
+			return fmt.Errorf("unknown modifier %s in %s", m, b.Attr)
+		case !keyEvents[b.Event]:
+			return fmt.Errorf("key filter %s in %s only applies to key events", m, b.Attr)
+		}
+	}
+	return nil
+}
+
+// matchesKey checks a key filter, e.g. "enter", "ctrl" or "a"
+func matchesKey(filter string, ev *Event) bool {
+	switch filter {
+	case "ctrl":
+		return ev.CtrlKey
+	case "alt":
+		return ev.AltKey
+	case "shift":
+		return ev.ShiftKey
+	case "meta":
+		return ev.MetaKey
+	}
+	if keys, ok := keyAliases[filter]; ok {
+		for _, k := range keys {
+			if ev.Key == k {
+				return true
+			}
+		}
+		return false
+	}
+	return ev.Key != "" && strings.EqualFold(ev.Key, filter)
+}
+
+// Matches checks if the event passes the binding's filters (.self and keys)
+func (b *EventBinding) Matches(ev *Event) bool {
+	if ev.Type != b.Event {
+		return false
+	}
+	for _, m := range b.Modifiers {
+		if m == "self" && !ev.Self {
+			return false
+		}
+		if !isEventModifier(m) && !matchesKey(m, ev) {
+			return false
+		}
+	}
+	return true
+}
+
+// An EventDispatch records how an event was dispatched to a binding
+type EventDispatch struct {
+	Binding         *EventBinding
+	Handled         bool // the handler was invoked
+	PreventDefault  bool
+	StopPropagation bool
+}
+
+// The EventDispatcher applies a binding's modifiers and invokes its handler.
+// It's shared by the bridges, so modifiers behave the same everywhere.
+type EventDispatcher struct {
+	// .once bindings that have been handled, by element id and attribute.
+	// Re-rendered elements keep their id, so the flag survives renders
+	// until the element is removed, see Forget
+	fired map[ElementID]map[string]bool
+}
+
+/*
+ * Dispatch dispatches ev to all of el's bindings for the event. For each
+ * binding that matches, apply is called first (if set) so the bridge can
+ * apply prevent/stop on the actual event, then the handler is invoked.
+ *
+ * prevent and stop only apply if the binding matches, e.g.
+ * g-on:keydown.enter.prevent only prevents the default for the enter key.
+ */
+func (d *EventDispatcher) Dispatch(el *Element, ev *Event, apply func(EventDispatch)) []EventDispatch {
+	var dispatches []EventDispatch
+
+	for _, b := range el.EventBindings() {
+		if !b.Matches(ev) {
+			continue
+		}
+		if b.Has("once") && d.fired[el.GetID()][b.Attr] {
+			continue
+		}
+		handler, ok := el.Handlers[b.Attr]
+
+		dispatch := EventDispatch{
+			Binding:         b,
+			Handled:         ok,
+			PreventDefault:  b.Has("prevent"),
+			StopPropagation: b.Has("stop"),
+		}
+		if apply != nil {
+			apply(dispatch)
+		}
+		if ok {
+			if b.Has("once") {
+				d.markFired(el.GetID(), b.Attr)
+			}
+			handler(ev)
+		}
+		dispatches = append(dispatches, dispatch)
+	}
+	return dispatches
+}
+
+func (d *EventDispatcher) markFired(id ElementID, attr string) {
+	if d.fired == nil {
+		d.fired = make(map[ElementID]map[string]bool)
+	}
+	if d.fired[id] == nil {
+		d.fired[id] = make(map[string]bool)
+	}
+	d.fired[id][attr] = true
+}
+
+// Forget clears the .once state of n and its descendants. Bridges call it
+// when n is removed, so an element added again with the same id starts over
+func (d *EventDispatcher) Forget(n Node) {
+	if len(d.fired) == 0 {
+		return
+	}
+	delete(d.fired, n.GetID())
+	if el, ok := n.(*Element); ok {
+		for _, c := range el.Children {
+			d.Forget(c)
+		}
+	}
+}
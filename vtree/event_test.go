@@ -0,0 +1,219 @@
+package vtree
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEventAttribute(t *testing.T) {
+	TestCases := map[string]struct {
+		Event     string
+		Modifiers string
+	}{
+		"g-click":                    {"click", ""},
+		"g-on:click":                 {"click", ""},
+		"g-on:keydown":               {"keydown", ""},
+		"@input":                     {"input", ""},
+		"@mouseover":                 {"mouseover", ""},
+		"g-on:submit.prevent":        {"submit", "prevent"},
+		"@keydown.enter.prevent":     {"keydown", "enter,prevent"},
+		"g-on:click.stop.once.self":  {"click", "stop,once,self"},
+		"@keyup.ctrl.enter":          {"keyup", "ctrl,enter"},
+		"g-on:keydown.esc.stop.once": {"keydown", "esc,stop,once"},
+	}
+
+	for Attr, TestCase := range TestCases {
+		t.Run(Attr, func(t *testing.T) {
+			binding, ok := ParseEventAttribute(Attr)
+			if !ok {
+				t.Fatalf("Expected %s to be an event attribute", Attr)
+			}
+			if binding.Event != TestCase.Event {
+				t.Errorf("Expected event %s, got %s", TestCase.Event, binding.Event)
+			}
+			if m := strings.Join(binding.Modifiers, ","); m != TestCase.Modifiers {
+				t.Errorf("Expected modifiers %s, got %s", TestCase.Modifiers, m)
+			}
+			if binding.Attr != Attr {
+				t.Errorf("Expected attribute %s, got %s", Attr, binding.Attr)
+			}
+		})
+	}
+
+	for _, Attr := range []string{"class", "g-value", "g-on:", "@", "@.prevent", "g-bind:click", "onclick"} {
+		t.Run(Attr, func(t *testing.T) {
+			if _, ok := ParseEventAttribute(Attr); ok {
+				t.Errorf("Didn't expect %s to be an event attribute", Attr)
+			}
+		})
+	}
+}
+
+func TestEventBindingMatches(t *testing.T) {
+	TestCases := map[string]struct {
+		Attr     string
+		Event    Event
+		Expected bool
+	}{
+		"Test plain":                  {"@click", Event{Type: "click"}, true},
+		"Test other event":            {"@click", Event{Type: "input"}, false},
+		"Test prevent doesn't filter": {"@submit.prevent", Event{Type: "submit"}, true},
+		"Test enter":                  {"@keydown.enter", Event{Type: "keydown", Key: "Enter"}, true},
+		"Test not enter":              {"@keydown.enter", Event{Type: "keydown", Key: "a"}, false},
+		"Test esc":                    {"@keyup.esc", Event{Type: "keyup", Key: "Escape"}, true},
+		"Test space":                  {"@keyup.space", Event{Type: "keyup", Key: " "}, true},
+		"Test arrow":                  {"@keydown.down", Event{Type: "keydown", Key: "ArrowDown"}, true},
+		"Test literal key":            {"@keydown.a", Event{Type: "keydown", Key: "A"}, true},
+		"Test system key":             {"@keydown.ctrl.enter", Event{Type: "keydown", Key: "Enter", CtrlKey: true}, true},
+		"Test missing system key":     {"@keydown.ctrl.enter", Event{Type: "keydown", Key: "Enter"}, false},
+		"Test self":                   {"@click.self", Event{Type: "click", Self: true}, true},
+		"Test not self":               {"@click.self", Event{Type: "click"}, false},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			binding, _ := ParseEventAttribute(TestCase.Attr)
+			if r := binding.Matches(&TestCase.Event); r != TestCase.Expected {
+				t.Errorf("Expected %v, got %v", TestCase.Expected, r)
+			}
+		})
+	}
+}
+
+func TestEventBindingCheck(t *testing.T) {
+	for _, Attr := range []string{"@click", "@submit.prevent", "@click.ctrl.stop.once.self",
+		"@keydown.enter", "@keyup.a", "@keydown.pagedown", "@keydown.f5", "@keyup.meta.z", "g-on:saved.once"} {
+		t.Run(Attr, func(t *testing.T) {
+			binding, _ := ParseEventAttribute(Attr)
+			if err := binding.Check(); err != nil {
+				t.Errorf("Unexpected error: %s", err)
+			}
+		})
+	}
+
+	for _, Attr := range []string{"@click.capture", "@scroll.passive", "@submit.prevnt", "@keydown.entr", "@click.enter", "@input.a"} {
+		t.Run(Attr, func(t *testing.T) {
+			binding, _ := ParseEventAttribute(Attr)
+			if err := binding.Check(); err == nil {
+				t.Errorf("Expected an error for %s", Attr)
+			}
+		})
+	}
+}
+
+func TestEventDispatcher(t *testing.T) {
+	setup := func() (*Element, *[]string) {
+		var handled []string
+		el := El("input").
+			A("@keydown.enter.prevent", "save").
+			A("@keydown.esc.stop", "cancel").
+			A("@click.once", "clicked")
+		for attr, name := range el.Attributes {
+			n := name
+			el.Handlers[attr] = func(ev *Event) {
+				handled = append(handled, n)
+			}
+		}
+		return el, &handled
+	}
+
+	t.Run("Test only matching binding handled", func(t *testing.T) {
+		el, handled := setup()
+		bridge := &DummyBridge{}
+
+		dispatches := bridge.TriggerEvent(el, &Event{Type: "keydown", Key: "Enter"})
+
+		if len(dispatches) != 1 || !dispatches[0].Handled {
+			t.Fatalf("Expected exactly one handled dispatch, got %v", dispatches)
+		}
+		if !dispatches[0].PreventDefault || dispatches[0].StopPropagation {
+			t.Errorf("Expected only prevent to be applied, got %+v", dispatches[0])
+		}
+		if r := strings.Join(*handled, ","); r != "save" {
+			t.Errorf("Expected save handler, got %s", r)
+		}
+	})
+
+	t.Run("Test stop", func(t *testing.T) {
+		el, handled := setup()
+		bridge := &DummyBridge{}
+
+		bridge.TriggerEvent(el, &Event{Type: "keydown", Key: "Escape"})
+
+		if len(bridge.Dispatched) != 1 || !bridge.Dispatched[0].StopPropagation || bridge.Dispatched[0].PreventDefault {
+			t.Errorf("Expected only stop to be applied, got %+v", bridge.Dispatched)
+		}
+		if r := strings.Join(*handled, ","); r != "cancel" {
+			t.Errorf("Expected cancel handler, got %s", r)
+		}
+	})
+
+	t.Run("Test no match, nothing applied", func(t *testing.T) {
+		el, handled := setup()
+		bridge := &DummyBridge{}
+
+		if d := bridge.TriggerEvent(el, &Event{Type: "keydown", Key: "x"}); len(d) != 0 {
+			t.Errorf("Expected no dispatches, got %v", d)
+		}
+		if len(*handled) != 0 {
+			t.Errorf("Expected no handlers called, got %v", *handled)
+		}
+	})
+
+	t.Run("Test once", func(t *testing.T) {
+		el, handled := setup()
+		bridge := &DummyBridge{}
+
+		bridge.TriggerEvent(el, &Event{Type: "click"})
+		bridge.TriggerEvent(el, &Event{Type: "click"})
+
+		// a re-rendered element with the same id is still done
+		rerendered := el.Clone().(*Element)
+		bridge.TriggerEvent(rerendered, &Event{Type: "click"})
+
+		if r := strings.Join(*handled, ","); r != "clicked" {
+			t.Errorf("Expected click handled once, got %s", r)
+		}
+	})
+
+	t.Run("Test once again after removal", func(t *testing.T) {
+		el, handled := setup()
+		parent := El("div").C(el)
+		bridge := &DummyBridge{}
+
+		bridge.TriggerEvent(el, &Event{Type: "click"})
+		bridge.Delete(parent)
+
+		if len(bridge.Events.fired) != 0 {
+			t.Errorf("Expected removal to clear the once state, got %v", bridge.Events.fired)
+		}
+
+		// added again with the same id, it's a new element
+		bridge.Add(el, nil)
+		bridge.TriggerEvent(el, &Event{Type: "click"})
+		bridge.TriggerEvent(el, &Event{Type: "click"})
+
+		if r := strings.Join(*handled, ","); r != "clicked,clicked" {
+			t.Errorf("Expected click handled once per insertion, got %s", r)
+		}
+	})
+
+	t.Run("Test apply called before handler", func(t *testing.T) {
+		el, handled := setup()
+		var order []string
+		el.Handlers["@keydown.enter.prevent"] = func(*Event) {
+			order = append(order, "handler")
+		}
+		dispatcher := &EventDispatcher{}
+		dispatcher.Dispatch(el, &Event{Type: "keydown", Key: "Enter"}, func(d EventDispatch) {
+			order = append(order, "apply")
+		})
+
+		if r := strings.Join(order, ","); r != "apply,handler" {
+			t.Errorf("Expected modifiers to be applied before the handler, got %s", r)
+		}
+		if len(*handled) != 0 {
+			t.Errorf("Unexpected handlers called: %v", *handled)
+		}
+	})
+}
@@ -8,44 +8,154 @@ import (
 	"github.com/go-gadget/gadget/j"
 )
 
-type ComponentRenderer func(*Element, NodeList)
+// A ComponentRenderer is called for each component element that's rendered,
+// with the content passed for its slots
+type ComponentRenderer func(*Element, Slots)
 
 type Renderer struct {
-	Handler   ComponentRenderer
-	InnerTree NodeList
+	Handler ComponentRenderer
+	// Slots holds the content passed to the component being rendered
+	Slots Slots
+	// SlotHandler is called for each slot filled with content from Slots
+	SlotHandler func(slot *Element, content *SlotContent)
+	// ErrorHandler receives errors encountered while rendering. If not
+	// set, errors are only logged
+	ErrorHandler func(error)
 }
 
 func NewRenderer() *Renderer {
 	return &Renderer{}
 }
 
+// error reports a rendering error. Rendering itself continues
+func (r *Renderer) error(err error) {
+	if r.ErrorHandler != nil {
+		r.ErrorHandler(err)
+		return
+	}
+	j.J("Render error", err.Error())
+}
+
+// eval evaluates a directive's expression. Failures are reported and
+// result in NotFound, so a single broken expression doesn't break rendering
+func (r *Renderer) eval(directive string, expression string, context *Context) reflect.Value {
+	value, err := Eval(expression, context)
+	if err != nil {
+		r.error(fmt.Errorf("could not evaluate %s: %s", directive, err))
+		return NotFound
+	}
+	return value
+}
+
 // RenderValue replaces g-value="expr" with the value from the context
-func (r *Renderer) RenderValue(e *Element, name string, context *Context) {
+func (r *Renderer) RenderValue(e *Element, expression string, context *Context) {
 	delete(e.Attributes, "g-value")
 
-	value := context.Get(name) // XXX check NotFound
-	// "de-reference" pointer? Necessary? Test!
-	if value.Kind() == reflect.Ptr {
-		value = value.Elem()
-	}
+	value := r.eval("g-value", expression, context)
 
 	e.Children = nil
-	// We rely on the string printing capabilities of the value,
-	// !v.Type().Implements(fmtStringerType)
-	e.T(fmt.Sprint(value))
+	e.T(Stringify(value))
 }
 
 // RenderIf returns the node with children if the g-if expression evaluates to true
-func (r *Renderer) RenderIf(e *Element, name string, context *Context) bool {
-	value := context.Get(name) // XXX check NotFound
-
-	if !value.Bool() {
+func (r *Renderer) RenderIf(e *Element, expression string, context *Context) bool {
+	if !Truthy(r.eval("g-if", expression, context)) {
 		return false
 	}
 	delete(e.Attributes, "g-if")
 	return true
 }
 
+// ForLoop holds the metadata of the current g-for iteration. It's available
+// within the loop as "forloop", e.g. g-class="forloop.Odd"
+type ForLoop struct {
+	Index  int  // 0-based position
+	Number int  // 1-based position
+	Length int  // total number of iterations
+	First  bool // first iteration
+	Last   bool // last iteration
+	Even   bool // Index is even (0, 2, 4, ..)
+	Odd    bool // Index is odd (1, 3, 5, ..)
+	// Parent is the enclosing loop's ForLoop, if any
+	Parent *ForLoop
+}
+
+func newForLoop(index int, length int, parent *ForLoop) *ForLoop {
+	return &ForLoop{
+		Index:  index,
+		Number: index + 1,
+		Length: length,
+		First:  index == 0,
+		Last:   index == length-1,
+		Even:   index%2 == 0,
+		Odd:    index%2 == 1,
+		Parent: parent,
+	}
+}
+
+// ParseForExpression splits a g-for expression into the variable(s) to
+// assign to and the expression to iterate over. Supported are:
+//
+// g-for="expr" - iterates over expr, assigns to _
+// g-for="item in expr" - iterates over expr, assigns to item
+// g-for="(i, item) in expr" - also assigns the index (or map key) to i
+//
+// See Iterate for what expr can evaluate to
+func ParseForExpression(expression string) (key string, value string, source string, err error) {
+	value = "_"
+	source = strings.TrimSpace(expression)
+
+	parts := strings.SplitN(expression, " in ", 2)
+	if len(parts) == 1 {
+		return "", value, source, nil
+	}
+	source = strings.TrimSpace(parts[1])
+	vars := strings.TrimSpace(parts[0])
+
+	if strings.HasPrefix(vars, "(") && strings.HasSuffix(vars, ")") {
+		vars = vars[1 : len(vars)-1]
+	}
+	names := strings.Split(vars, ",")
+	if len(names) > 2 {
+		return "", "", "", fmt.Errorf("invalid g-for expression %q: at most two variables can be assigned", expression)
+	}
+	for i, name := range names {
+		names[i] = strings.TrimSpace(name)
+		if !isIdentifier(names[i]) {
+			return "", "", "", fmt.Errorf("invalid g-for expression %q: %q is not a variable name", expression, names[i])
+		}
+	}
+	if len(names) == 2 {
+		return names[0], names[1], source, nil
+	}
+	return "", names[0], source, nil
+}
+
+func isIdentifier(name string) bool {
+	expr, err := ParseExpr(name)
+	if err != nil {
+		return false
+	}
+	_, ok := expr.(*identNode)
+	return ok
+}
+
+// key evaluates a g-key expression, if there is one
+func (r *Renderer) key(expression string, keyed bool, context *Context) (string, bool) {
+	if !keyed {
+		return "", false
+	}
+	value := r.eval("g-key", expression, context)
+	if value == NotFound {
+		return "", false
+	}
+	return Stringify(value), true
+}
+
+func keyedID(id ElementID, key string) ElementID {
+	return ElementID(fmt.Sprintf("%s-k%s", id, key))
+}
+
 // RenderFor handles g-for, duplicating the node for each iteration
 func (r *Renderer) RenderFor(e *Element, expression string, context *Context) (result []*Element) {
 	/*
@@ -56,27 +166,53 @@ func (r *Renderer) RenderFor(e *Element, expression string, context *Context) (r
 	 *
 	 * Also: set key / id
 	 *
-	 * Syntax:
-	 * g-for="variable" - iterates over variable, assings to _
-	 * g-for="variable in variable" - iterates over last variable, assigns to first
+	 * See ParseForExpression for the syntax
 	 */
-	name := expression
-	assign := "_"
-	if strings.Contains(expression, " in ") {
-		parts := strings.Split(expression, " in ")
-		assign = strings.Trim(parts[0], " ")
-		name = strings.Trim(parts[1], " ")
+	delete(e.Attributes, "g-for")
+
+	keyVar, valueVar, source, err := ParseForExpression(expression)
+	if err != nil {
+		r.error(err)
+		return nil
 	}
 
-	value := context.Get(name) // XXX Check NotFound
+	keys, values, err := Iterate(r.eval("g-for", source, context))
+	if err != nil {
+		r.error(fmt.Errorf("%s in g-for %q", err, expression))
+		return nil
+	}
 
-	// must be an array of something
-	// field.Kind is any of reflect.Array, reflect.Map, reflect.Slice, reflect.String:
-	delete(e.Attributes, "g-for")
-	for i := 0; i < value.Len(); i++ {
+	var parent *ForLoop
+	if p := context.Get("forloop"); p.IsValid() && p.CanInterface() {
+		parent, _ = p.Interface().(*ForLoop)
+	}
+
+	// With g-key, the ID of each clone is derived from the item, in stead
+	// of its position. This keeps ID's stable when items are inserted,
+	// removed or reordered.
+	keyExpr, keyed := e.Attributes["g-key"]
+	delete(e.Attributes, "g-key")
+	seen := make(map[string]bool)
+
+	length := len(values)
+	for i, value := range values {
 		m := context.Mark()
-		context.PushValue(assign, value.Index(i))
-		clone := e.DeepClone(ElementID(fmt.Sprintf("%s-%d", e.ID, i))).(*Element)
+		context.Push("forloop", newForLoop(i, length, parent))
+		if keyVar != "" {
+			context.PushValue(keyVar, keys[i])
+		}
+		context.PushValue(valueVar, value)
+
+		id := ElementID(fmt.Sprintf("%s-%d", e.ID, i))
+		if key, ok := r.key(keyExpr, keyed, context); ok {
+			if seen[key] {
+				r.error(fmt.Errorf("duplicate g-key %q in g-for %q", key, expression))
+			} else {
+				seen[key] = true
+				id = keyedID(e.ID, key)
+			}
+		}
+		clone := e.DeepClone(id).(*Element)
 
 		res := r.Render(clone, context)
 		result = append(result, res...)
@@ -110,47 +246,55 @@ func (r *Renderer) RenderClass(e *Element, classes string, context *Context) {
 	// are attributes clones?
 	delete(e.Attributes, "g-class")
 
-	value := context.Get(classes) // XXX Check NotFound
+	value := Stringify(r.eval("g-class", classes, context))
 
 	ClassAttr, ok := e.Attributes["class"]
 	if ok {
-		ClassAttr += " " + value.String()
+		ClassAttr += " " + value
 	} else {
-		ClassAttr = value.String()
+		ClassAttr = value
 	}
 	e.Attributes["class"] = ClassAttr
 	/// XXX TODO deduplicate
 }
 
 // RenderBind scans the attributes in e for g-bind:<attr> or :<attr>
-// looks up the value in the context and sets it as an attribute on the
-// element. If not found, nothing will be set (so a default may persist)
+// evaluates the expression and sets the result as an attribute on the
+// element. If it can't be evaluated, nothing will be set (so a default may persist)
+//
+// The actual value is kept in BoundValues, which is what components get as
+// prop (and scoped slots expose). Since these don't need the attribute, it's
+// only set for values that have a sensible string form, not for e.g. a []Todo
 func (r *Renderer) RenderBind(e *Element, context *Context) {
 	for k, v := range e.Attributes {
 		if strings.HasPrefix(k, "g-bind:") || strings.HasPrefix(k, ":") {
-			attr := strings.SplitN(k, ":", 2)[1]
-			if value := context.Get(v); value != NotFound {
-				// For now attrs are always strings XXX
-				e.Attributes[attr] = fmt.Sprint(value)
-			} else {
-				j.J("Could not get value for g-bind attr " + attr)
+			// templates written for the XML parser use ::attr, it
+			// stripped the first : as namespace separator
+			attr := strings.TrimLeft(strings.TrimPrefix(k, "g-bind"), ":")
+			if value := r.eval("g-bind:"+attr, v, context); value != NotFound {
+				if e.BoundValues == nil {
+					e.BoundValues = make(map[string]reflect.Value)
+				}
+				e.BoundValues[attr] = value
+				if !(e.IsComponent() || e.Type == "slot") || isScalar(value) {
+					e.Attributes[attr] = Stringify(value)
+				}
 			}
 			delete(e.Attributes, k)
 		}
 	}
 }
 
-// RenderSlot replaces the special <slot></slot> tag with the contents
-// of the component it's part of
-func (r *Renderer) RenderSlot(e *Element, context *Context) []*Element {
-	// If there's no content, keep whatever <slot> currently contains (default)
-	if len(r.InnerTree) != 0 {
-		e.Children = make(NodeList, len(r.InnerTree))
-		for i, ie := range r.InnerTree {
-			e.Children[i] = ie
-		}
+// isScalar checks if a value is a bool, number or string
+func isScalar(value reflect.Value) bool {
+	switch indirect(value).Kind() {
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
 	}
-	return []*Element{e}
+	return false
 }
 
 func (r *Renderer) Render(e *Element, context *Context) []*Element {
@@ -164,6 +308,14 @@ func (r *Renderer) Render(e *Element, context *Context) []*Element {
 	// entirely correct
 	clone := e.Clone().(*Element)
 
+	// g-else(-if) only has meaning relative to its siblings, which are
+	// handled by RenderChildren
+	if isElseBranch(e) {
+		r.error(fmt.Errorf("orphaned %s on <%s>: it must directly follow a sibling with g-if or g-else-if",
+			elseDirective(e), e.Type))
+		return nil
+	}
+
 	if gValue, ok := clone.Attributes["g-for"]; ok {
 		// g-for will recurse on itself for each itertion, which will
 		// deal with g-value, g-if, g-class, etc.
@@ -176,6 +328,15 @@ func (r *Renderer) Render(e *Element, context *Context) []*Element {
 		}
 	}
 
+	// g-key outside of a g-for ties the element's identity to the key:
+	// when the key changes, the element is replaced
+	if gValue, ok := clone.Attributes["g-key"]; ok {
+		delete(clone.Attributes, "g-key")
+		if key, ok := r.key(gValue, true, context); ok {
+			clone = clone.DeepClone(keyedID(e.ID, key)).(*Element)
+		}
+	}
+
 	// g-bind:attr or just ":attr". Since we don't know
 	// what attr looks like, we need to iterate over all attributes
 	// Also, bind goes before class, so g-class wins from g-bind:class
@@ -194,44 +355,115 @@ func (r *Renderer) Render(e *Element, context *Context) []*Element {
 	// g-bind should take the property and set it as attribute on the rendered
 	// element XXX
 
-	if e.Type == "slot" {
-		r.RenderSlot(clone, context)
+	if e.Type == "slot" && r.RenderSlot(clone, context) {
+		return []*Element{clone}
 	}
 
-	// Render the contents of the component, then call the component handler with it.
+	// Collect the contents of the component (unrendered, it's rendered
+	// by the component), then call the component handler with it.
 	if e.IsComponent() {
-		// A component renders to at most 1 element (but could be text?)
-		var inner NodeList
-		if len(e.Children) > 0 {
-			if ce, ok := e.Children[0].(*Element); ok {
-				for _, ee := range r.Render(ce, context) {
-					inner = append(inner, ee)
-				}
-			} else {
-				inner = e.Children
-			}
-		}
+		slots := r.CollectSlots(e.Children, context)
 		clone.Children = nil
 		if r.Handler != nil {
 			m := context.Mark()
-			r.Handler(clone, inner)
+			r.Handler(clone, slots)
 			context.Pop(m)
 		}
 	}
 	// XXX make this optional: deep vs. shallow
-	Children := clone.Children
-	clone.Children = nil
-
-	for _, c := range Children {
-		if el, ok := c.(*Element); ok {
-			for _, cc := range r.Render(el, context) {
-				if cc != nil {
-					clone.C(cc)
+	clone.Children = r.RenderChildren(clone.Children, context)
+
+	// g-model goes last, a <select> needs its (rendered) options
+	if attr, _, ok := clone.ModelAttribute(); ok {
+		r.RenderModel(clone, clone.Attributes[attr], context)
+	}
+
+	return []*Element{clone}
+}
+
+func isElseBranch(e *Element) bool {
+	return elseDirective(e) != ""
+}
+
+func elseDirective(e *Element) string {
+	if _, ok := e.Attributes["g-else-if"]; ok {
+		return "g-else-if"
+	}
+	if _, ok := e.Attributes["g-else"]; ok {
+		return "g-else"
+	}
+	return ""
+}
+
+/*
+ * RenderChildren renders a list of sibling nodes. Besides rendering each
+ * element, it resolves conditional chains:
+ *
+ * <p g-if="a">..</p><p g-else-if="b">..</p><p g-else>..</p>
+ *
+ * At most one branch of a chain is rendered. A chain is started by an
+ * element with g-if (but not g-for, where g-if filters items) and may only
+ * be interrupted by whitespace.
+ */
+func (r *Renderer) RenderChildren(children NodeList, context *Context) NodeList {
+	var result NodeList
+
+	inChain := false // the previous element can be followed by g-else(-if)
+	taken := false   // a branch of the current chain was rendered
+
+	for _, c := range children {
+		el, ok := c.(*Element)
+		if !ok {
+			// whitespace and comments don't break a g-if/g-else chain
+			switch n := c.(type) {
+			case *Text:
+				if strings.TrimSpace(n.Text) != "" {
+					inChain = false
 				}
+			case *Comment:
+			default:
+				inChain = false
+			}
+			result = append(result, c)
+			continue
+		}
+
+		if directive := elseDirective(el); directive != "" {
+			if !inChain {
+				r.error(fmt.Errorf("orphaned %s on <%s>: it must directly follow a sibling with g-if or g-else-if",
+					directive, el.Type))
+				continue
+			}
+			// nothing can follow a g-else
+			inChain = directive == "g-else-if"
+
+			if taken {
+				continue
+			}
+			if directive == "g-else-if" && !Truthy(r.eval("g-else-if", el.Attributes["g-else-if"], context)) {
+				continue
+			}
+			taken = true
+
+			branch := el.Clone().(*Element)
+			delete(branch.Attributes, directive)
+			for _, cc := range r.Render(branch, context) {
+				result = append(result, cc)
+			}
+			continue
+		}
+
+		_, hasIf := el.Attributes["g-if"]
+		_, hasFor := el.Attributes["g-for"]
+		inChain = hasIf && !hasFor
+
+		rendered := r.Render(el, context)
+		taken = len(rendered) > 0
+		for _, cc := range rendered {
+			if cc != nil {
+				result = append(result, cc)
 			}
-		} else {
-			clone.C(c)
 		}
 	}
-	return []*Element{clone}
+	return result
 }
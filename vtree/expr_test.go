@@ -3,6 +3,7 @@ package vtree
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -338,3 +339,506 @@ func TestBind(t *testing.T) {
 		AssertAttribute(t, res[0], "class", "style1 style2")
 	})
 }
+
+func TestDirectiveExpressions(t *testing.T) {
+	t.Run("Test g-if comparison", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").A("g-if", "count > 3")
+		ctx := &Context{}
+		ctx.Push("count", 4)
+
+		AssertElementCount(t, renderer.Render(e, ctx), 1)
+
+		ctx.Push("count", 3)
+		AssertElementCount(t, renderer.Render(e, ctx), 0)
+	})
+	t.Run("Test g-if negation", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").A("g-if", "!done")
+		ctx := &Context{}
+		ctx.Push("done", false)
+
+		AssertElementCount(t, renderer.Render(e, ctx), 1)
+	})
+	t.Run("Test g-if undefined is false", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").A("g-if", "doesnotexist")
+
+		AssertElementCount(t, renderer.Render(e, &Context{}), 0)
+	})
+	t.Run("Test g-value field access", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").A("g-value", "user.Name")
+		ctx := &Context{}
+		ctx.Push("user", &struct{ Name string }{"Ivo"})
+		res := renderer.Render(e, ctx)
+
+		AssertTextNode(t, res[0].Children[0], "Ivo")
+	})
+	t.Run("Test g-value concatenation", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").A("g-value", `"Hello " + name + "!"`)
+		ctx := &Context{}
+		ctx.Push("name", "World")
+		res := renderer.Render(e, ctx)
+
+		AssertTextNode(t, res[0].Children[0], "Hello World!")
+	})
+	t.Run("Test g-for over field", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("li").A("g-for", "tag in user.Tags").A("g-value", "tag")
+		ctx := &Context{}
+		ctx.Push("user", struct{ Tags []string }{[]string{"a", "b"}})
+		res := renderer.Render(e, ctx)
+
+		AssertElementCount(t, res, 2)
+		AssertTextNode(t, res[1].Children[0], "b")
+	})
+	t.Run("Test g-class expression", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").A("g-class", `"item-" + index`)
+		ctx := &Context{}
+		ctx.Push("index", 3)
+		res := renderer.Render(e, ctx)
+
+		AssertAttribute(t, res[0], "class", "item-3")
+	})
+	t.Run("Test g-bind expression", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("a").A("g-bind:href", `"/user/" + user.ID`)
+		ctx := &Context{}
+		ctx.Push("user", struct{ ID int }{12})
+		res := renderer.Render(e, ctx)
+
+		AssertAttribute(t, res[0], "href", "/user/12")
+	})
+}
+
+func TestElseChains(t *testing.T) {
+	chain := func() *Element {
+		return El("div").C(
+			El("p").A("g-if", "n == 1").T("one"),
+			El("p").A("g-else-if", "n == 2").T("two"),
+			El("p").A("g-else-if", "n == 3").T("three"),
+			El("p").A("g-else", "").T("many"),
+		)
+	}
+
+	TestCases := map[string]struct {
+		N        int
+		Expected string
+	}{
+		"Test g-if branch":         {1, "<div><p>one</p></div>"},
+		"Test first g-else-if":     {2, "<div><p>two</p></div>"},
+		"Test second g-else-if":    {3, "<div><p>three</p></div>"},
+		"Test g-else branch":       {4, "<div><p>many</p></div>"},
+		"Test g-else on zero case": {0, "<div><p>many</p></div>"},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			renderer := NewRenderer()
+			ctx := &Context{}
+			ctx.Push("n", TestCase.N)
+			res := renderer.Render(chain(), ctx)
+
+			if r := res[0].ToString(); r != TestCase.Expected {
+				t.Errorf("Didn't get expected result, got %s", r)
+			}
+		})
+	}
+
+	t.Run("Test chain without g-else", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").C(
+			El("p").A("g-if", "a").T("a"),
+			El("p").A("g-else-if", "b").T("b"),
+		)
+		ctx := &Context{}
+		ctx.Push("a", false)
+		ctx.Push("b", false)
+
+		if r := renderer.Render(e, ctx)[0].ToString(); r != "<div></div>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+
+	t.Run("Test whitespace between branches", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").C(El("p").A("g-if", "a").T("a"))
+		e.T("\n  ")
+		e.C(El("p").A("g-else", "").T("else"))
+		ctx := &Context{}
+		ctx.Push("a", false)
+
+		if r := renderer.Render(e, ctx)[0].ToString(); r != "<div>\n  <p>else</p></div>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+
+	t.Run("Test consecutive chains", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").C(
+			El("p").A("g-if", "a").T("a"),
+			El("p").A("g-else", "").T("not a"),
+			El("p").A("g-if", "b").T("b"),
+			El("p").A("g-else", "").T("not b"),
+		)
+		ctx := &Context{}
+		ctx.Push("a", true)
+		ctx.Push("b", false)
+
+		if r := renderer.Render(e, ctx)[0].ToString(); r != "<div><p>a</p><p>not b</p></div>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+
+	t.Run("Test directive removed from rendered branch", func(t *testing.T) {
+		renderer := NewRenderer()
+		e := El("div").C(
+			El("p").A("g-if", "a"),
+			El("p").A("g-else-if", "true").A("class", "x"),
+		)
+		ctx := &Context{}
+		ctx.Push("a", false)
+		res := renderer.Render(e, ctx)
+
+		AssertElementAttributes(t, res[0].Children[0].(*Element), Attributes{"class": "x"})
+		AssertAttributeNotPresent(t, res[0].Children[0].(*Element), "g-else-if")
+	})
+}
+
+func TestOrphanedElse(t *testing.T) {
+	TestCases := map[string]*Element{
+		"Test g-else without g-if": El("div").C(
+			El("p").T("a"),
+			El("p").A("g-else", "").T("else"),
+		),
+		"Test g-else-if without g-if": El("div").C(
+			El("p").A("g-else-if", "true").T("else"),
+		),
+		"Test g-else after g-else": El("div").C(
+			El("p").A("g-if", "false"),
+			El("p").A("g-else", ""),
+			El("p").A("g-else", "").T("else"),
+		),
+		"Test g-else separated by text": El("div").C(
+			El("p").A("g-if", "false"),
+			&Text{Text: "interrupted"},
+			El("p").A("g-else", "").T("else"),
+		),
+		"Test g-else after g-for": El("div").C(
+			El("p").A("g-for", "items").A("g-if", "false"),
+			El("p").A("g-else", "").T("else"),
+		),
+		"Test g-else on root": El("p").A("g-else", "").T("else"),
+	}
+
+	for Name, e := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			var errors []error
+			renderer := NewRenderer()
+			renderer.ErrorHandler = func(err error) {
+				errors = append(errors, err)
+			}
+			ctx := &Context{}
+			ctx.Push("items", []int{1})
+			res := renderer.Render(e, ctx)
+
+			if len(errors) != 1 {
+				t.Fatalf("Expected exactly 1 error, got %v", errors)
+			}
+			if !strings.Contains(errors[0].Error(), "orphaned g-else") {
+				t.Errorf("Expected orphaned g-else error, got %s", errors[0])
+			}
+			for _, el := range res {
+				if strings.Contains(el.ToString(), "else") {
+					t.Errorf("Did not expect orphaned branch to be rendered, got %s", el.ToString())
+				}
+			}
+		})
+	}
+}
+
+func TestParseForExpression(t *testing.T) {
+	TestCases := map[string]struct {
+		Key, Value, Source string
+	}{
+		"items":                {"", "_", "items"},
+		"item in items":        {"", "item", "items"},
+		"item in user.Items":   {"", "item", "user.Items"},
+		"(item) in items":      {"", "item", "items"},
+		"(i, item) in items":   {"i", "item", "items"},
+		" ( i ,item )  in  xs": {"i", "item", "xs"},
+	}
+
+	for Expr, TestCase := range TestCases {
+		t.Run(Expr, func(t *testing.T) {
+			key, value, source, err := ParseForExpression(Expr)
+			if err != nil {
+				t.Fatalf("Unexpected error %s", err)
+			}
+			if key != TestCase.Key || value != TestCase.Value || source != TestCase.Source {
+				t.Errorf("Unexpected result %q, %q, %q", key, value, source)
+			}
+		})
+	}
+
+	for _, Expr := range []string{"(a, b, c) in items", "(a, ) in items", "1 in items", "a.b in items"} {
+		t.Run(Expr, func(t *testing.T) {
+			if _, _, _, err := ParseForExpression(Expr); err == nil {
+				t.Errorf("Expected %s to fail", Expr)
+			}
+		})
+	}
+}
+
+func TestForLoopVariables(t *testing.T) {
+	render := func(tpl string, items interface{}) string {
+		renderer := NewRenderer()
+		ctx := &Context{}
+		ctx.Push("items", items)
+		return renderer.Render(Parse(tpl), ctx)[0].ToString()
+	}
+
+	t.Run("Test index variable", func(t *testing.T) {
+		r := render(`<ul><li g-for="(i, item) in items" g-value="i + ':' + item"></li></ul>`, []string{"a", "b"})
+
+		if r != "<ul><li>0:a</li><li>1:b</li></ul>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+	t.Run("Test index and number", func(t *testing.T) {
+		r := render(`<ul><li g-for="items" g-value="forloop.Index + '/' + forloop.Number"></li></ul>`, []int{5, 6})
+
+		if r != "<ul><li>0/1</li><li>1/2</li></ul>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+	t.Run("Test zebra striping", func(t *testing.T) {
+		r := render(`<ul><li g-for="items" g-bind:class="forloop.Even" g-class="forloop.Odd"></li></ul>`, []int{1, 2, 3})
+
+		if r != `<ul><li class="true false"></li><li class="false true"></li><li class="true false"></li></ul>` {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+	t.Run("Test first and last", func(t *testing.T) {
+		r := render(`<p><b g-for="item in items"><i g-if="forloop.First">[</i><i g-value="item"></i><i g-if="!forloop.Last">, </i><i g-else>]</i></b></p>`,
+			[]string{"a", "b", "c"})
+
+		if r != "<p><b><i>[</i><i>a</i><i>, </i></b><b><i>b</i><i>, </i></b><b><i>c</i><i>]</i></b></p>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+	t.Run("Test single element is first and last", func(t *testing.T) {
+		r := render(`<ul><li g-for="items" g-if="forloop.First &amp;&amp; forloop.Last">only</li></ul>`, []int{1})
+
+		if r != "<ul><li>only</li></ul>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+	t.Run("Test nested loops with parent", func(t *testing.T) {
+		r := render(`<div><p g-for="row in items"><b g-for="row" g-value="forloop.Parent.Index + '.' + forloop.Index"></b></p></div>`,
+			[][]int{{1, 2}, {3}})
+
+		if r != "<div><p><b>0.0</b><b>0.1</b></p><p><b>1.0</b></p></div>" {
+			t.Errorf("Didn't get expected result, got %s", r)
+		}
+	})
+	t.Run("Test forloop restored after loop", func(t *testing.T) {
+		renderer := NewRenderer()
+		ctx := &Context{}
+		ctx.Push("items", []int{1, 2})
+		renderer.Render(El("li").A("g-for", "items"), ctx)
+
+		if v := ctx.Get("forloop"); v != NotFound {
+			t.Errorf("Expected forloop to be popped from context, got %v", v)
+		}
+	})
+	t.Run("Test non-iterable", func(t *testing.T) {
+		var errors []error
+		renderer := NewRenderer()
+		renderer.ErrorHandler = func(err error) { errors = append(errors, err) }
+		ctx := &Context{}
+		ctx.Push("items", true)
+		res := renderer.Render(El("li").A("g-for", "items"), ctx)
+
+		AssertElementCount(t, res, 0)
+		if len(errors) != 1 {
+			t.Errorf("Expected an error, got %v", errors)
+		}
+	})
+}
+
+func TestForSequences(t *testing.T) {
+	render := func(tpl string, value interface{}) string {
+		renderer := NewRenderer()
+		ctx := &Context{}
+		ctx.Push("value", value)
+		return renderer.Render(Parse(tpl), ctx)[0].ToString()
+	}
+
+	TestCases := map[string]struct {
+		Template string
+		Value    interface{}
+		Expected string
+	}{
+		"Test map key and value": {
+			`<dl><dd g-for="(k, v) in value" g-value="k + '=' + v"></dd></dl>`,
+			map[string]int{"b": 2, "a": 1},
+			"<dl><dd>a=1</dd><dd>b=2</dd></dl>",
+		},
+		"Test map values": {
+			`<dl><dd g-for="v in value" g-value="v"></dd></dl>`,
+			map[string]int{"b": 2, "a": 1},
+			"<dl><dd>1</dd><dd>2</dd></dl>",
+		},
+		"Test string": {
+			`<p><b g-for="c in value" g-value="c"></b></p>`,
+			"gö",
+			"<p><b>g</b><b>ö</b></p>",
+		},
+		"Test integer range": {
+			`<p><b g-for="n in 3" g-value="n"></b></p>`,
+			nil,
+			"<p><b>0</b><b>1</b><b>2</b></p>",
+		},
+		"Test integer range expression": {
+			`<p><b g-for="n in value + 1" g-value="n"></b></p>`,
+			1,
+			"<p><b>0</b><b>1</b></p>",
+		},
+		"Test Sequence with forloop": {
+			`<p><b g-for="w in value" g-if="forloop.Last" g-value="w"></b></p>`,
+			&wordList{[]string{"a", "b"}},
+			"<p><b>B</b></p>",
+		},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			if r := render(TestCase.Template, TestCase.Value); r != TestCase.Expected {
+				t.Errorf("Didn't get expected result, got %s", r)
+			}
+		})
+	}
+}
+
+func TestForKey(t *testing.T) {
+	type Todo struct {
+		ID    int
+		Title string
+	}
+
+	render := func(renderer *Renderer, e *Element, todos []Todo) []*Element {
+		ctx := &Context{}
+		ctx.Push("todos", todos)
+		return renderer.Render(e, ctx)
+	}
+
+	t.Run("Test ids derived from key", func(t *testing.T) {
+		e := El("li").A("g-for", "todo in todos").A("g-key", "todo.ID").A("g-value", "todo.Title")
+		res := render(NewRenderer(), e, []Todo{{7, "a"}, {3, "b"}})
+
+		AssertElementCount(t, res, 2)
+		AssertNodeID(t, res[0].ID, ElementID(fmt.Sprintf("%s-k7", e.ID)))
+		AssertNodeID(t, res[1].ID, ElementID(fmt.Sprintf("%s-k3", e.ID)))
+		AssertAttributeNotPresent(t, res[0], "g-key")
+	})
+
+	t.Run("Test ids stable on insert", func(t *testing.T) {
+		e := El("ul").C(El("li").A("g-for", "todo in todos").A("g-key", "todo.ID").A("g-value", "todo.Title"))
+		renderer := NewRenderer()
+		before := render(renderer, e, []Todo{{1, "a"}, {2, "b"}, {3, "c"}})[0]
+		after := render(renderer, e, []Todo{{0, "new"}, {1, "a"}, {2, "b"}, {3, "c"}})[0]
+
+		for i, c := range before.Children {
+			AssertNodeID(t, after.Children[i+1].GetID(), c.GetID())
+		}
+
+		changes := Diff(before, after)
+		AssertChangeCount(t, changes, 2)
+		AssertAddChange(t, changes[0], after.Children[0].GetID())
+	})
+
+	t.Run("Test duplicate keys", func(t *testing.T) {
+		var errors []error
+		renderer := NewRenderer()
+		renderer.ErrorHandler = func(err error) { errors = append(errors, err) }
+		e := El("li").A("g-for", "todo in todos").A("g-key", "todo.ID")
+		res := render(renderer, e, []Todo{{1, "a"}, {1, "b"}})
+
+		if len(errors) != 1 {
+			t.Errorf("Expected exactly one error, got %v", errors)
+		}
+		if res[0].ID == res[1].ID {
+			t.Errorf("Expected distinct ids, got %s twice", res[0].ID)
+		}
+	})
+
+	t.Run("Test key outside loop", func(t *testing.T) {
+		e := El("div").A("g-key", "todos[0].ID").C(El("p"))
+		renderer := NewRenderer()
+		one := render(renderer, e, []Todo{{1, "a"}})[0]
+		other := render(renderer, e, []Todo{{2, "a"}})[0]
+
+		AssertNodeID(t, one.ID, ElementID(fmt.Sprintf("%s-k1", e.ID)))
+		changes := Diff(one, other)
+		AssertChangeCount(t, changes, 1)
+		AssertReplaceChange(t, changes[0], one.ID, other.ID)
+	})
+}
+
+func TestRenderBindValues(t *testing.T) {
+	type Todo struct {
+		Title string
+	}
+	ctx := &Context{}
+	ctx.Push("todos", []Todo{{"a"}, {"b"}})
+	ctx.Push("count", 2)
+
+	t.Run("Test component gets actual values", func(t *testing.T) {
+		e := El("todo-list").A(":todos", "todos").A(":count", "count")
+		res := NewRenderer().Render(e, ctx)[0]
+
+		if todos, ok := res.BoundValues["todos"].Interface().([]Todo); !ok || len(todos) != 2 {
+			t.Errorf("Expected the bound []Todo, got %v", res.BoundValues["todos"])
+		}
+		if count := res.BoundValues["count"].Interface(); count != 2 {
+			t.Errorf("Expected the bound int, got %v", count)
+		}
+		AssertAttributeNotPresent(t, res, "todos")
+		AssertAttribute(t, res, "count", "2")
+	})
+
+	t.Run("Test double colon", func(t *testing.T) {
+		e := El("todo-list").A("::count", "count")
+		res := NewRenderer().Render(e, ctx)[0]
+
+		if count := res.BoundValues["count"].Interface(); count != 2 {
+			t.Errorf("Expected the bound int, got %v", count)
+		}
+		AssertAttributeNotPresent(t, res, "::count")
+	})
+
+	t.Run("Test elements get string attributes", func(t *testing.T) {
+		e := El("div").A(":todos", "todos")
+		res := NewRenderer().Render(e, ctx)[0]
+
+		AssertAttribute(t, res, "todos", "[{a} {b}]")
+	})
+
+	t.Run("Test bound values are cloned", func(t *testing.T) {
+		e := El("todo-list").A(":todos", "todos")
+		res := NewRenderer().Render(e, ctx)[0]
+		clone := res.Clone().(*Element)
+		clone.BoundValues["other"] = reflect.ValueOf(1)
+
+		if _, ok := clone.BoundValues["todos"]; !ok {
+			t.Error("Expected bound values to be copied")
+		}
+		if _, ok := res.BoundValues["other"]; ok {
+			t.Error("Expected original bound values to be unaffected")
+		}
+	})
+}
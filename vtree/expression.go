@@ -0,0 +1,813 @@
+package vtree
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+/*
+ * A small expression language for the g-* directives, evaluated against a
+ * *Context. It's loosely modelled after Go expressions:
+ *
+ * - literals: 42, 3.14, "text", 'text', true, false, nil
+ * - names, looked up in the context: count, _
+ * - field / map access: user.Name, settings.theme
+ * - indexing: items[0], m["key"], items[i + 1]
+ * - unary: !done, -x
+ * - arithmetic: + - * / % (+ concatenates if either side is a string)
+ * - comparison: == != < <= > >=
+ * - boolean logic: && || (short-circuiting)
+ * - grouping: (a || b) && c
+ *
+ * Expressions are parsed once and cached by their source.
+ */
+
+// An Expr is a parsed expression that can be evaluated against a Context
+type Expr interface {
+	Eval(ctx *Context) (reflect.Value, error)
+	String() string
+}
+
+// ExprError describes a failure to parse or evaluate an expression
+type ExprError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("%s (in expression %q at offset %d)", e.Msg, e.Expr, e.Pos)
+}
+
+var (
+	exprCacheLock sync.Mutex
+	exprCache     = make(map[string]Expr)
+)
+
+// ParseExpr parses src into an Expr, or returns an *ExprError
+func ParseExpr(src string) (Expr, error) {
+	exprCacheLock.Lock()
+	expr, ok := exprCache[src]
+	exprCacheLock.Unlock()
+	if ok {
+		return expr, nil
+	}
+
+	p := &exprParser{lexer: &exprLexer{src: src}}
+	p.next()
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %s", p.tok)
+	}
+
+	exprCacheLock.Lock()
+	exprCache[src] = expr
+	exprCacheLock.Unlock()
+	return expr, nil
+}
+
+// Eval parses and evaluates src against ctx. A src that literally matches a
+// variable name in the context is returned directly, so names that aren't
+// valid identifiers (e.g. "my-class") keep working.
+func Eval(src string, ctx *Context) (reflect.Value, error) {
+	if v := ctx.Get(strings.TrimSpace(src)); v != NotFound {
+		return v, nil
+	}
+	expr, err := ParseExpr(src)
+	if err != nil {
+		return NotFound, err
+	}
+	return expr.Eval(ctx)
+}
+
+// Truthy implements generic truthiness: false, zero numbers, empty
+// strings/collections, nil and NotFound are false, everything else is true
+func Truthy(v reflect.Value) bool {
+	v = indirectInterface(v)
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() != 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() != 0
+	case reflect.Complex64, reflect.Complex128:
+		return v.Complex() != 0
+	case reflect.String, reflect.Array, reflect.Slice, reflect.Map, reflect.Chan:
+		return v.Len() > 0
+	case reflect.Ptr, reflect.Func, reflect.UnsafePointer:
+		return !v.IsNil()
+	}
+	return true
+}
+
+// indirectInterface unwraps interface values, e.g. values taken from a
+// map[string]interface{}
+func indirectInterface(v reflect.Value) reflect.Value {
+	for v.IsValid() && v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return NotFound
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// indirect unwraps both interfaces and pointers
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return NotFound
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+/*
+ * Lexer
+ */
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokInt
+	tokFloat
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+type exprLexer struct {
+	src string
+	pos int
+}
+
+// two-character operators are matched before single characters
+var exprOperators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"+", "-", "*", "/", "%", "<", ">", "!", "(", ")", "[", "]", ".", ",",
+}
+
+func (l *exprLexer) error(pos int, msg string) *ExprError {
+	return &ExprError{Expr: l.src, Pos: pos, Msg: msg}
+}
+
+func (l *exprLexer) next() (token, error) {
+	for l.pos < len(l.src) && strings.ContainsRune(" \t\r\n", rune(l.src[l.pos])) {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, pos: start}, nil
+	}
+
+	r, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	switch {
+	case r == '_' || unicode.IsLetter(r):
+		for l.pos < len(l.src) {
+			r, size = utf8.DecodeRuneInString(l.src[l.pos:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			l.pos += size
+		}
+		return token{kind: tokIdent, text: l.src[start:l.pos], pos: start}, nil
+	case r >= '0' && r <= '9':
+		kind := tokInt
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if c == '.' && kind == tokInt && l.pos+1 < len(l.src) && l.src[l.pos+1] >= '0' && l.src[l.pos+1] <= '9' {
+				kind = tokFloat
+			} else if c < '0' || c > '9' {
+				break
+			}
+			l.pos++
+		}
+		return token{kind: kind, text: l.src[start:l.pos], pos: start}, nil
+	case r == '"' || r == '\'':
+		return l.lexString(r)
+	}
+
+	for _, op := range exprOperators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return token{kind: tokOp, text: op, pos: start}, nil
+		}
+	}
+	return token{}, l.error(start, fmt.Sprintf("unexpected character %q", r))
+}
+
+func (l *exprLexer) lexString(quote rune) (token, error) {
+	start := l.pos
+	l.pos++ // opening quote
+	var b strings.Builder
+
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case rune(c) == quote:
+			l.pos++
+			return token{kind: tokString, text: b.String(), pos: start}, nil
+		case c == '\\' && l.pos+1 < len(l.src):
+			// Let strconv deal with the escape sequence itself
+			value, _, tail, err := strconv.UnquoteChar(l.src[l.pos:], byte(quote))
+			if err != nil {
+				return token{}, l.error(l.pos, "invalid escape sequence in string")
+			}
+			b.WriteRune(value)
+			l.pos = len(l.src) - len(tail)
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return token{}, l.error(start, "unterminated string")
+}
+
+/*
+ * Parser, plain recursive descent. Lowest to highest precedence:
+ *
+ * ||
+ * &&
+ * == != < <= > >=
+ * + -
+ * * / %
+ * unary ! -
+ * postfix .field [index]
+ */
+
+type exprParser struct {
+	lexer *exprLexer
+	tok   token
+	err   error
+}
+
+func (p *exprParser) next() {
+	if p.err != nil {
+		return
+	}
+	p.tok, p.err = p.lexer.next()
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.lexer.error(p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) isOp(ops ...string) bool {
+	if p.tok.kind != tokOp {
+		return false
+	}
+	for _, op := range ops {
+		if p.tok.text == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *exprParser) parseExpr() (Expr, error) {
+	return p.parseBinary(0)
+}
+
+var binaryPrecedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">="},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (Expr, error) {
+	if level == len(binaryPrecedence) {
+		return p.parseUnary()
+	}
+	left, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp(binaryPrecedence[level]...) {
+		op := p.tok
+		p.next()
+		right, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op.text, pos: op.pos, src: p.lexer.src, left: left, right: right}
+	}
+	return left, p.err
+}
+
+func (p *exprParser) parseUnary() (Expr, error) {
+	if p.isOp("!", "-") {
+		op := p.tok
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op.text, pos: op.pos, src: p.lexer.src, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (Expr, error) {
+	expr, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.isOp("."):
+			p.next()
+			if p.tok.kind != tokIdent {
+				return nil, p.errorf("expected field name after '.', got %s", p.tok)
+			}
+			expr = &fieldNode{target: expr, name: p.tok.text, pos: p.tok.pos, src: p.lexer.src}
+			p.next()
+		case p.isOp("["):
+			pos := p.tok.pos
+			p.next()
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp("]") {
+				return nil, p.errorf("expected ']', got %s", p.tok)
+			}
+			p.next()
+			expr = &indexNode{target: expr, index: index, pos: pos, src: p.lexer.src}
+		default:
+			return expr, p.err
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (Expr, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	tok := p.tok
+
+	switch tok.kind {
+	case tokIdent:
+		p.next()
+		switch tok.text {
+		case "true":
+			return &literalNode{text: tok.text, value: reflect.ValueOf(true)}, nil
+		case "false":
+			return &literalNode{text: tok.text, value: reflect.ValueOf(false)}, nil
+		case "nil":
+			return &literalNode{text: tok.text, value: NotFound}, nil
+		}
+		return &identNode{name: tok.text, pos: tok.pos, src: p.lexer.src}, nil
+	case tokInt:
+		p.next()
+		i, err := strconv.Atoi(tok.text)
+		if err != nil {
+			return nil, p.lexer.error(tok.pos, "invalid integer "+tok.text)
+		}
+		return &literalNode{text: tok.text, value: reflect.ValueOf(i)}, nil
+	case tokFloat:
+		p.next()
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.lexer.error(tok.pos, "invalid number "+tok.text)
+		}
+		return &literalNode{text: tok.text, value: reflect.ValueOf(f)}, nil
+	case tokString:
+		p.next()
+		return &literalNode{text: strconv.Quote(tok.text), value: reflect.ValueOf(tok.text)}, nil
+	case tokOp:
+		if tok.text == "(" {
+			p.next()
+			expr, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOp(")") {
+				return nil, p.errorf("expected ')', got %s", p.tok)
+			}
+			p.next()
+			return expr, nil
+		}
+	}
+	return nil, p.errorf("unexpected %s", tok)
+}
+
+/*
+ * AST nodes
+ */
+
+type literalNode struct {
+	text  string
+	value reflect.Value
+}
+
+func (n *literalNode) Eval(ctx *Context) (reflect.Value, error) {
+	return n.value, nil
+}
+
+func (n *literalNode) String() string {
+	return n.text
+}
+
+type identNode struct {
+	name string
+	pos  int
+	src  string
+}
+
+func (n *identNode) Eval(ctx *Context) (reflect.Value, error) {
+	if v := ctx.Get(n.name); v != NotFound {
+		return v, nil
+	}
+	return NotFound, &ExprError{Expr: n.src, Pos: n.pos, Msg: "undefined variable " + n.name}
+}
+
+func (n *identNode) String() string {
+	return n.name
+}
+
+type fieldNode struct {
+	target Expr
+	name   string
+	pos    int
+	src    string
+}
+
+func (n *fieldNode) Eval(ctx *Context) (reflect.Value, error) {
+	target, err := n.target.Eval(ctx)
+	if err != nil {
+		return NotFound, err
+	}
+	v := indirect(target)
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if sf, ok := v.Type().FieldByName(n.name); ok {
+			f, nilPtr := fieldByIndex(v, sf.Index)
+			if nilPtr.IsValid() {
+				return NotFound, &ExprError{Expr: n.src, Pos: n.pos,
+					Msg: fmt.Sprintf("can't get field %s of nil %s", n.name, nilPtr.Type())}
+			}
+			return f, nil
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			key := reflect.ValueOf(n.name).Convert(v.Type().Key())
+			if f := v.MapIndex(key); f.IsValid() {
+				return f, nil
+			}
+		}
+	case reflect.Invalid:
+		return NotFound, &ExprError{Expr: n.src, Pos: n.pos, Msg: "can't get field " + n.name + " of nil"}
+	}
+	return NotFound, &ExprError{Expr: n.src, Pos: n.pos,
+		Msg: fmt.Sprintf("%s has no field %s", v.Type(), n.name)}
+}
+
+func (n *fieldNode) String() string {
+	return n.target.String() + "." + n.name
+}
+
+type indexNode struct {
+	target Expr
+	index  Expr
+	pos    int
+	src    string
+}
+
+func (n *indexNode) error(msg string) error {
+	return &ExprError{Expr: n.src, Pos: n.pos, Msg: msg}
+}
+
+func (n *indexNode) Eval(ctx *Context) (reflect.Value, error) {
+	target, err := n.target.Eval(ctx)
+	if err != nil {
+		return NotFound, err
+	}
+	index, err := n.index.Eval(ctx)
+	if err != nil {
+		return NotFound, err
+	}
+	v := indirect(target)
+	index = indirectInterface(index)
+
+	switch v.Kind() {
+	case reflect.Array, reflect.Slice, reflect.String:
+		i, ok := toInt(index)
+		if !ok {
+			return NotFound, n.error(fmt.Sprintf("can't index %s with %s", v.Type(), typeName(index)))
+		}
+		if i < 0 || i >= int64(v.Len()) {
+			return NotFound, n.error(fmt.Sprintf("index %d out of range (length %d)", i, v.Len()))
+		}
+		return v.Index(int(i)), nil
+	case reflect.Map:
+		keyType := v.Type().Key()
+		if !index.IsValid() || !index.Type().ConvertibleTo(keyType) {
+			return NotFound, n.error(fmt.Sprintf("can't index %s with %s", v.Type(), typeName(index)))
+		}
+		if r := v.MapIndex(index.Convert(keyType)); r.IsValid() {
+			return r, nil
+		}
+		// Like Go, a missing key gives the zero value
+		return reflect.Zero(v.Type().Elem()), nil
+	case reflect.Invalid:
+		return NotFound, n.error("can't index nil")
+	}
+	return NotFound, n.error(fmt.Sprintf("can't index %s", v.Type()))
+}
+
+func (n *indexNode) String() string {
+	return n.target.String() + "[" + n.index.String() + "]"
+}
+
+type unaryNode struct {
+	op      string
+	operand Expr
+	pos     int
+	src     string
+}
+
+func (n *unaryNode) Eval(ctx *Context) (reflect.Value, error) {
+	v, err := n.operand.Eval(ctx)
+	if err != nil {
+		return NotFound, err
+	}
+	if n.op == "!" {
+		return reflect.ValueOf(!Truthy(v)), nil
+	}
+
+	v = indirectInterface(v)
+	if i, ok := toInt(v); ok {
+		return reflect.ValueOf(-i), nil
+	}
+	if f, ok := toFloat(v); ok {
+		return reflect.ValueOf(-f), nil
+	}
+	return NotFound, &ExprError{Expr: n.src, Pos: n.pos,
+		Msg: "can't negate " + typeName(v)}
+}
+
+func (n *unaryNode) String() string {
+	return n.op + n.operand.String()
+}
+
+type binaryNode struct {
+	op          string
+	left, right Expr
+	pos         int
+	src         string
+}
+
+func (n *binaryNode) error(msg string) error {
+	return &ExprError{Expr: n.src, Pos: n.pos, Msg: msg}
+}
+
+func (n *binaryNode) Eval(ctx *Context) (reflect.Value, error) {
+	left, err := n.left.Eval(ctx)
+	if err != nil {
+		return NotFound, err
+	}
+
+	// short-circuit boolean logic
+	switch n.op {
+	case "&&":
+		if !Truthy(left) {
+			return reflect.ValueOf(false), nil
+		}
+	case "||":
+		if Truthy(left) {
+			return reflect.ValueOf(true), nil
+		}
+	}
+
+	right, err := n.right.Eval(ctx)
+	if err != nil {
+		return NotFound, err
+	}
+	left, right = indirectInterface(left), indirectInterface(right)
+
+	switch n.op {
+	case "&&", "||":
+		return reflect.ValueOf(Truthy(right)), nil
+	case "==", "!=":
+		eq, err := n.equal(left, right)
+		if err != nil {
+			return NotFound, err
+		}
+		return reflect.ValueOf(eq == (n.op == "==")), nil
+	case "<", "<=", ">", ">=":
+		return n.compare(left, right)
+	}
+	return n.arithmetic(left, right)
+}
+
+func (n *binaryNode) equal(left, right reflect.Value) (bool, error) {
+	if !left.IsValid() || !right.IsValid() {
+		return isNil(left) && isNil(right), nil
+	}
+	if l, ok := toInt(left); ok {
+		if r, ok := toInt(right); ok {
+			return l == r, nil
+		}
+	}
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return l == r, nil
+		}
+	}
+	if left.Kind() == reflect.String && right.Kind() == reflect.String {
+		return left.String() == right.String(), nil
+	}
+	if left.Kind() == reflect.Bool && right.Kind() == reflect.Bool {
+		return left.Bool() == right.Bool(), nil
+	}
+	if !left.CanInterface() || !right.CanInterface() {
+		return false, n.error(fmt.Sprintf("can't compare %s and %s", left.Type(), right.Type()))
+	}
+	return reflect.DeepEqual(left.Interface(), right.Interface()), nil
+}
+
+func (n *binaryNode) compare(left, right reflect.Value) (reflect.Value, error) {
+	var cmp int
+
+	if l, ok := toInt(left); ok {
+		if r, ok := toInt(right); ok {
+			cmp = compareOrdered(l < r, l > r)
+			return reflect.ValueOf(compareResult(n.op, cmp)), nil
+		}
+	}
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			cmp = compareOrdered(l < r, l > r)
+			return reflect.ValueOf(compareResult(n.op, cmp)), nil
+		}
+	}
+	if left.Kind() == reflect.String && right.Kind() == reflect.String {
+		cmp = strings.Compare(left.String(), right.String())
+		return reflect.ValueOf(compareResult(n.op, cmp)), nil
+	}
+	return NotFound, n.error(fmt.Sprintf("can't compare %s and %s using %s",
+		typeName(left), typeName(right), n.op))
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	}
+	if greater {
+		return 1
+	}
+	return 0
+}
+
+func compareResult(op string, cmp int) bool {
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+func (n *binaryNode) arithmetic(left, right reflect.Value) (reflect.Value, error) {
+	if n.op == "+" && (left.Kind() == reflect.String || right.Kind() == reflect.String) {
+		return reflect.ValueOf(Stringify(left) + Stringify(right)), nil
+	}
+
+	if l, ok := toInt(left); ok {
+		if r, ok := toInt(right); ok {
+			switch n.op {
+			case "+":
+				return reflect.ValueOf(l + r), nil
+			case "-":
+				return reflect.ValueOf(l - r), nil
+			case "*":
+				return reflect.ValueOf(l * r), nil
+			case "/", "%":
+				if r == 0 {
+					return NotFound, n.error("division by zero")
+				}
+				if n.op == "/" {
+					return reflect.ValueOf(l / r), nil
+				}
+				return reflect.ValueOf(l % r), nil
+			}
+		}
+	}
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			switch n.op {
+			case "+":
+				return reflect.ValueOf(l + r), nil
+			case "-":
+				return reflect.ValueOf(l - r), nil
+			case "*":
+				return reflect.ValueOf(l * r), nil
+			case "/":
+				if r == 0 {
+					return NotFound, n.error("division by zero")
+				}
+				return reflect.ValueOf(l / r), nil
+			}
+		}
+	}
+	return NotFound, n.error(fmt.Sprintf("invalid operation %s %s %s",
+		typeName(left), n.op, typeName(right)))
+}
+
+func (n *binaryNode) String() string {
+	return "(" + n.left.String() + " " + n.op + " " + n.right.String() + ")"
+}
+
+/*
+ * Helpers for converting values
+ */
+
+func toInt(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+func toFloat(v reflect.Value) (float64, bool) {
+	if i, ok := toInt(v); ok {
+		return float64(i), true
+	}
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
+
+func isNil(v reflect.Value) bool {
+	v = indirectInterface(v)
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return v.IsNil()
+	}
+	return false
+}
+
+func typeName(v reflect.Value) string {
+	if !v.IsValid() {
+		return "nil"
+	}
+	return v.Type().String()
+}
+
+// Stringify converts an evaluated value into its textual representation,
+// dereferencing pointers. NotFound/nil becomes the empty string.
+func Stringify(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	// We rely on the string printing capabilities of the value,
+	// which also works for values of unexported fields
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,178 @@
+package vtree
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type exprUser struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Friend  *exprUser
+	private bool
+}
+
+type exprMember struct {
+	*exprUser
+	Since int
+}
+
+func exprTestContext() *Context {
+	ctx := &Context{}
+	ctx.Push("count", 5)
+	ctx.Push("price", 2.5)
+	ctx.Push("done", false)
+	ctx.Push("name", "gadget")
+	ctx.Push("empty", "")
+	ctx.Push("items", []string{"a", "b", "c"})
+	ctx.Push("user", &exprUser{Name: "Ivo", Age: 42, Tags: []string{"go"},
+		Friend: &exprUser{Name: "Bob"}, private: true})
+	ctx.Push("settings", map[string]interface{}{"theme": "dark", "size": 3})
+	ctx.Push("byID", map[int]string{1: "one", 2: "two"})
+	ctx.Push("specific-class", "literal")
+	ctx.Push("member", exprMember{exprUser: &exprUser{Name: "Ann"}})
+	ctx.Push("guest", exprMember{})
+	return ctx
+}
+
+func TestEvalExpressions(t *testing.T) {
+	TestCases := map[string]struct {
+		Expr     string
+		Expected string
+	}{
+		"Identifier":                  {"count", "5"},
+		"Int literal":                 {"42", "42"},
+		"Float literal":               {"1.5", "1.5"},
+		"Double quoted string":        {`"hello"`, "hello"},
+		"Single quoted string":        {`'hello'`, "hello"},
+		"Escaped string":              {`'it\'s'`, "it's"},
+		"Bool literal":                {"true", "true"},
+		"Field access":                {"user.Name", "Ivo"},
+		"Nested field access":         {"user.Friend.Name", "Bob"},
+		"Unexported field access":     {"user.private", "true"},
+		"Map field access":            {"settings.theme", "dark"},
+		"Promoted field access":       {"member.Name", "Ann"},
+		"Slice index":                 {"items[1]", "b"},
+		"Computed index":              {"items[count - 3]", "c"},
+		"Map index":                   {`settings["size"]`, "3"},
+		"Int keyed map index":         {"byID[2]", "two"},
+		"Missing map key":             {"byID[3]", ""},
+		"Index on field":              {"user.Tags[0]", "go"},
+		"Addition":                    {"count + 2", "7"},
+		"Precedence":                  {"1 + 2 * 3", "7"},
+		"Grouping":                    {"(1 + 2) * 3", "9"},
+		"Modulo":                      {"count % 2", "1"},
+		"Integer division":            {"count / 2", "2"},
+		"Mixed int/float":             {"count * price", "12.5"},
+		"Negation":                    {"-count", "-5"},
+		"String concatenation":        {`name + "!"`, "gadget!"},
+		"Concatenate with number":     {`"n=" + count`, "n=5"},
+		"Greater than":                {"count > 3", "true"},
+		"Less or equal":               {"count <= 4", "false"},
+		"String comparison":           {`name == "gadget"`, "true"},
+		"String ordering":             {`"a" < "b"`, "true"},
+		"Not equal":                   {"user.Age != 42", "false"},
+		"Nil comparison":              {"user.Friend.Friend == nil", "true"},
+		"Not":                         {"!done", "true"},
+		"Not on empty string":         {"!empty", "true"},
+		"And":                         {"count > 3 && !done", "true"},
+		"Or":                          {"done || count == 5", "true"},
+		"Short circuit and":           {"done && undefined", "false"},
+		"Short circuit or":            {"!done || undefined", "true"},
+		"Literal name with dash":      {"specific-class", "literal"},
+		"Whitespace is insignificant": {"  count   >=5 ", "true"},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			value, err := Eval(TestCase.Expr, exprTestContext())
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if s := Stringify(value); s != TestCase.Expected {
+				t.Errorf("Expected %s to evaluate to '%s', got '%s'", TestCase.Expr, TestCase.Expected, s)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	TestCases := map[string]string{
+		"Undefined variable":    "doesnotexist",
+		"Unknown field":         "user.Nope",
+		"Field of nil":          "user.Friend.Friend.Name",
+		"Promoted field of nil": "guest.Name",
+		"Index out of range":    "items[10]",
+		"Bad index type":        `items["x"]`,
+		"Division by zero":      "count / 0",
+		"Invalid operation":     "items - 1",
+		"Invalid comparison":    "items < 1",
+		"Unterminated string":   `"hello`,
+		"Unbalanced parens":     "(count + 1",
+		"Trailing tokens":       "count count",
+		"Unexpected character":  "count # 2",
+		"Dangling operator":     "count +",
+	}
+
+	for Name, Expr := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			_, err := Eval(Expr, exprTestContext())
+			if err == nil {
+				t.Fatalf("Expected %s to fail", Expr)
+			}
+			if _, ok := err.(*ExprError); !ok {
+				t.Errorf("Expected an *ExprError, got %T", err)
+			}
+		})
+	}
+}
+
+func TestParseExprCached(t *testing.T) {
+	one, err := ParseExpr("a.b[c] + 1")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	other, _ := ParseExpr("a.b[c] + 1")
+
+	if one != other {
+		t.Error("Expected parsed expression to be cached")
+	}
+	if s := one.String(); s != "(a.b[c] + 1)" {
+		t.Errorf("Unexpected string representation %s", s)
+	}
+}
+
+func TestTruthy(t *testing.T) {
+	var nilPtr *exprUser
+
+	TestCases := []struct {
+		Value    interface{}
+		Expected bool
+	}{
+		{true, true},
+		{false, false},
+		{1, true},
+		{0, false},
+		{uint8(0), false},
+		{0.1, true},
+		{"", false},
+		{"x", true},
+		{[]int{}, false},
+		{[]int{1}, true},
+		{map[string]int{}, false},
+		{nilPtr, false},
+		{&exprUser{}, true},
+		{exprUser{}, true},
+		{nil, false},
+	}
+
+	for _, TestCase := range TestCases {
+		t.Run(fmt.Sprintf("%#v", TestCase.Value), func(t *testing.T) {
+			if r := Truthy(reflect.ValueOf(TestCase.Value)); r != TestCase.Expected {
+				t.Errorf("Expected %v, got %v", TestCase.Expected, r)
+			}
+		})
+	}
+}
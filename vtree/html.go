@@ -0,0 +1,160 @@
+package vtree
+
+import (
+	"html"
+	"io"
+	"sort"
+	"strings"
+)
+
+/*
+ * HTMLRenderer writes a (rendered) tree as HTML5, e.g. to serve it from a
+ * server. Text and attribute values are escaped, void elements don't get an
+ * end tag and fragments are written as their children.
+ *
+ * Directives that are left after rendering, like g-on:click and g-model,
+ * only mean something to the bridge and are left out.
+ *
+ * The browser has no node for empty text and joins adjacent text, so with
+ * Markers an empty comment is written for empty text and between adjacent
+ * text (except in <textarea> and the like, where it would be text itself).
+ * Hydrate copes without them, but can't tell e.g. "a" "b" from "ab" "".
+ */
+type HTMLRenderer struct {
+	// Markers adds data-gid="<id>" to elements, so the client can match
+	// them with its own tree
+	Markers bool
+	// Content returns the content of a component element, e.g. the tree of
+	// the component mounted on it. If nil, its children are written
+	Content func(component *Element) Node
+}
+
+// MarkerAttribute is the attribute HTMLRenderer writes element ids to
+const MarkerAttribute = "data-gid"
+
+// htmlWriter keeps the first error, so writes don't need checking
+type htmlWriter struct {
+	w   io.Writer
+	err error
+	// the last node written was text
+	text bool
+}
+
+func (hw *htmlWriter) write(s ...string) {
+	for _, part := range s {
+		if hw.err != nil {
+			return
+		}
+		_, hw.err = io.WriteString(hw.w, part)
+	}
+}
+
+// Render writes node, and everything below it, to w
+func (h *HTMLRenderer) Render(w io.Writer, node Node) error {
+	hw := &htmlWriter{w: w}
+	h.render(hw, node)
+	return hw.err
+}
+
+// String returns node as HTML
+func (h *HTMLRenderer) String(node Node) string {
+	var b strings.Builder
+	h.Render(&b, node)
+	return b.String()
+}
+
+func (h *HTMLRenderer) render(hw *htmlWriter, node Node) {
+	switch n := node.(type) {
+	case *Text:
+		if h.Markers && (n.Text == "" || hw.text) {
+			hw.write(separator)
+		}
+		hw.write(html.EscapeString(n.Text))
+		hw.text = n.Text != ""
+	case *Comment:
+		hw.write("<!--", commentText(n.Text), "-->")
+		hw.text = false
+	case *Element:
+		h.renderElement(hw, n)
+	}
+}
+
+func (h *HTMLRenderer) renderElement(hw *htmlWriter, el *Element) {
+	if el.IsFragment() {
+		for _, c := range el.Children {
+			h.render(hw, c)
+		}
+		return
+	}
+
+	hw.text = false
+	hw.write("<", el.Type)
+	if h.Markers {
+		hw.write(" ", MarkerAttribute, `="`, html.EscapeString(string(el.ID)), `"`)
+	}
+	// sorted, so the output is stable
+	var attrs []string
+	for attr := range el.Attributes {
+		if !isDirective(attr) {
+			attrs = append(attrs, attr)
+		}
+	}
+	sort.Strings(attrs)
+	for _, attr := range attrs {
+		if value := el.Attributes[attr]; value != "" {
+			hw.write(" ", attr, `="`, html.EscapeString(value), `"`)
+		} else {
+			hw.write(" ", attr)
+		}
+	}
+	hw.write(">")
+
+	lower := strings.ToLower(el.Type)
+	if voidElements[lower] {
+		return
+	}
+
+	children := el.Children
+	if el.IsComponent() && h.Content != nil {
+		children = nil
+		if content := h.Content(el); content != nil {
+			children = NodeList{content}
+		}
+	}
+	_, raw := rawTextElements[lower]
+	for _, c := range children {
+		// a separator would be text in these. <script> and <style> can't
+		// contain references, their text is written as is
+		if t, ok := c.(*Text); ok && raw {
+			if isRawText(lower) {
+				hw.write(t.Text)
+			} else {
+				hw.write(html.EscapeString(t.Text))
+			}
+			continue
+		}
+		h.render(hw, c)
+	}
+	hw.write("</", el.Type, ">")
+	hw.text = false
+}
+
+// separator is written for empty and between adjacent text
+const separator = "<!---->"
+
+// commentText is the text of a comment as written, "--" can't be escaped
+// in a comment
+func commentText(text string) string {
+	return strings.Replace(text, "--", "- -", -1)
+}
+
+// isRawText tells if the text of an element is written without escaping
+func isRawText(name string) bool {
+	decode, ok := rawTextElements[name]
+	return ok && !decode
+}
+
+// isDirective tells if an attribute is for gadget, not for the browser
+func isDirective(attr string) bool {
+	return strings.HasPrefix(attr, "g-") || strings.HasPrefix(attr, ":") || strings.HasPrefix(attr, "@")
+}
@@ -0,0 +1,65 @@
+package vtree
+
+import (
+	"testing"
+)
+
+func TestHTMLRenderer(t *testing.T) {
+	TestCases := map[string]struct {
+		Node     Node
+		Expected string
+	}{
+		"Escaped text": {El("p").T(`<b> & "c"`),
+			"<p>&lt;b&gt; &amp; &#34;c&#34;</p>"},
+		"Escaped attribute": {El("a").A("title", `"quoted" & <b>`),
+			`<a title="&#34;quoted&#34; &amp; &lt;b&gt;"></a>`},
+		"Sorted attributes": {El("input").A("type", "text").A("name", "q").A("disabled", ""),
+			`<input disabled name="q" type="text">`},
+		"Void elements": {El("div").C(El("br"), El("img").A("src", "a.png")),
+			`<div><br><img src="a.png"></div>`},
+		"Directives left out": {El("button").A("g-on:click", "save").A("g-model", "x").A("class", "btn"),
+			`<button class="btn"></button>`},
+		"Fragment": {Fragment(El("h1"), El("p")),
+			"<h1></h1><p></p>"},
+		"Raw text": {El("script").T("if (a < b) {}"),
+			"<script>if (a < b) {}</script>"},
+		"Comment": {El("div").C(&Comment{Text: " a -- b "}),
+			"<div><!-- a - - b --></div>"},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			if r := (&HTMLRenderer{}).String(TestCase.Node); r != TestCase.Expected {
+				t.Errorf("Expected %s, got %s", TestCase.Expected, r)
+			}
+		})
+	}
+
+	t.Run("Test markers", func(t *testing.T) {
+		el := El("div").SetID("a").C(El("p").SetID("b").T("x"))
+		if r := (&HTMLRenderer{Markers: true}).String(el); r != `<div data-gid="a"><p data-gid="b">x</p></div>` {
+			t.Errorf("Didn't get expected markers, got %s", r)
+		}
+	})
+
+	t.Run("Test text separators", func(t *testing.T) {
+		el := El("div").SetID("a").C(&Text{Text: ""}, El("p").SetID("b"), &Text{Text: "a"},
+			Fragment(&Text{Text: "b"}, &Text{Text: ""}), &Text{Text: "c"}, El("textarea").SetID("c").C(&Text{Text: "d"}, &Text{Text: "e"}))
+		expected := `<div data-gid="a"><!----><p data-gid="b"></p>a<!---->b<!---->c<textarea data-gid="c">de</textarea></div>`
+		if r := (&HTMLRenderer{Markers: true}).String(el); r != expected {
+			t.Errorf("Expected %s, got %s", expected, r)
+		}
+		if r := (&HTMLRenderer{}).String(el); r != "<div><p></p>abc<textarea>de</textarea></div>" {
+			t.Errorf("Didn't expect separators without markers, got %s", r)
+		}
+	})
+
+	t.Run("Test component content", func(t *testing.T) {
+		renderer := &HTMLRenderer{Content: func(component *Element) Node {
+			return El("b").T(component.Type)
+		}}
+		if r := renderer.String(El("div").C(El("x-comp"))); r != "<div><x-comp><b>x-comp</b></x-comp></div>" {
+			t.Errorf("Didn't get expected content, got %s", r)
+		}
+	})
+}
@@ -0,0 +1,205 @@
+package vtree
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+ * Hydration attaches a bridge to markup that was rendered on the server
+ * (see HTMLRenderer) in stead of creating the elements again.
+ *
+ * Every Gadget has its own IDSource, so a client rendering the same app
+ * as the server hands out the same ids. Nodes are matched by position and
+ * an element's id must be the data-gid the server wrote for it. This
+ * catches e.g. a <tbody> the browser inserted by itself, or a client that
+ * rendered something else first.
+ *
+ * Hydration either matches a whole tree or nothing, the bridge renders it
+ * from scratch on a mismatch. Blank text and comments the server didn't
+ * write (e.g. around the app's markup) are skipped.
+ *
+ * The browser has no node for empty text and joins adjacent text. Empty
+ * text gets a new DOM node, and a DOM text node that starts with the text
+ * is split. The DOM may have changed when hydration fails.
+ */
+
+// DOM node types, as in the DOM's nodeType
+const (
+	ElementNode = 1
+	TextNode    = 3
+	CommentNode = 8
+)
+
+// A DOMNode is the part of a DOM node hydration needs. The DOM bridge wraps
+// the browser's nodes, tests can use a fake DOM
+type DOMNode interface {
+	NodeType() int
+	TagName() string
+	Attribute(name string) (string, bool)
+	NodeValue() string
+	ChildNodes() []DOMNode
+	// InsertText adds a text node before child, at the end if child is nil
+	InsertText(text string, before DOMNode) DOMNode
+	// SplitText splits the text node child after offset bytes, it returns
+	// the new node with the rest of the text
+	SplitText(child DOMNode, offset int) DOMNode
+}
+
+// Hydrater can be implemented by bridges that hydrate markup during the
+// first loop. Gadget tells it when that loop is over
+type Hydrater interface {
+	EndHydration()
+}
+
+// A HydrationError reports where the markup doesn't match the tree
+type HydrationError struct {
+	Node Node // the node that was expected, nil for a surplus DOM node
+	Msg  string
+}
+
+func (e *HydrationError) Error() string {
+	if e.Node == nil {
+		return "hydration mismatch: " + e.Msg
+	}
+	return fmt.Sprintf("hydration mismatch at %s: %s", describeNode(e.Node), e.Msg)
+}
+
+func describeNode(n Node) string {
+	switch node := n.(type) {
+	case *Element:
+		return fmt.Sprintf("<%s> (%s)", node.Type, node.ID)
+	case *Text:
+		return fmt.Sprintf("text %q (%s)", node.Text, node.ID)
+	}
+	return fmt.Sprintf("comment (%s)", n.GetID())
+}
+
+// insertNode inserts d in dom at i
+func insertNode(dom []DOMNode, i int, d DOMNode) []DOMNode {
+	dom = append(dom, nil)
+	copy(dom[i+1:], dom[i:])
+	dom[i] = d
+	return dom
+}
+
+// Hydrate matches tree with the DOM children of parent. It returns the DOM
+// node for every node in the tree, for a fragment that's parent.
+// The content of component elements isn't matched, it's added (and hydrated)
+// when their component is
+func Hydrate(tree Node, parent DOMNode) (map[ElementID]DOMNode, error) {
+	nodes := make(map[ElementID]DOMNode)
+	if err := hydrateChildren(nodes, NodeList{tree}, parent); err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
+
+// flatten replaces fragments by their children, registering parent for them
+func flatten(nodes map[ElementID]DOMNode, list NodeList, parent DOMNode) NodeList {
+	var res NodeList
+	for _, n := range list {
+		if el, ok := n.(*Element); ok && el.IsFragment() {
+			nodes[el.ID] = parent
+			res = append(res, flatten(nodes, el.Children, parent)...)
+			continue
+		}
+		res = append(res, n)
+	}
+	return res
+}
+
+// ignorable tells if a DOM node may be skipped when it doesn't match
+func ignorable(d DOMNode) bool {
+	switch d.NodeType() {
+	case TextNode:
+		return strings.TrimSpace(d.NodeValue()) == ""
+	case CommentNode:
+		return true
+	}
+	return false
+}
+
+func hydrateChildren(nodes map[ElementID]DOMNode, list NodeList, parent DOMNode) error {
+	dom := parent.ChildNodes()
+	i := 0
+	for _, n := range flatten(nodes, list, parent) {
+		t, text := n.(*Text)
+		if text && t.Text == "" {
+			var before DOMNode
+			if i < len(dom) {
+				before = dom[i]
+			}
+			d := parent.InsertText("", before)
+			dom = insertNode(dom, i, d)
+			nodes[n.GetID()] = d
+			i++
+			continue
+		}
+		for i < len(dom) && ignorable(dom[i]) && !matches(n, dom[i]) {
+			i++
+		}
+		if i == len(dom) {
+			return &HydrationError{Node: n, Msg: "no markup found"}
+		}
+		if value := dom[i].NodeValue(); text && dom[i].NodeType() == TextNode &&
+			len(value) > len(t.Text) && strings.HasPrefix(value, t.Text) {
+			dom = insertNode(dom, i+1, parent.SplitText(dom[i], len(t.Text)))
+		}
+		if err := hydrateNode(nodes, n, dom[i]); err != nil {
+			return err
+		}
+		i++
+	}
+	for ; i < len(dom); i++ {
+		if !ignorable(dom[i]) {
+			return &HydrationError{Msg: fmt.Sprintf("unexpected %s in <%s>",
+				describeDOMNode(dom[i]), strings.ToLower(parent.TagName()))}
+		}
+	}
+	return nil
+}
+
+func describeDOMNode(d DOMNode) string {
+	if d.NodeType() == ElementNode {
+		return "<" + strings.ToLower(d.TagName()) + ">"
+	}
+	return fmt.Sprintf("text %q", d.NodeValue())
+}
+
+// matches tells if d is the DOM node for n, without looking at children
+func matches(n Node, d DOMNode) bool {
+	switch node := n.(type) {
+	case *Text:
+		return d.NodeType() == TextNode && d.NodeValue() == node.Text
+	case *Comment:
+		// the renderer may have changed the text, see HTMLRenderer
+		return d.NodeType() == CommentNode && d.NodeValue() == commentText(node.Text)
+	case *Element:
+		return d.NodeType() == ElementNode && strings.EqualFold(d.TagName(), node.Type)
+	}
+	return false
+}
+
+func hydrateNode(nodes map[ElementID]DOMNode, n Node, d DOMNode) error {
+	if !matches(n, d) {
+		return &HydrationError{Node: n, Msg: "found " + describeDOMNode(d)}
+	}
+	nodes[n.GetID()] = d
+
+	el, ok := n.(*Element)
+	if !ok {
+		return nil
+	}
+	id, marked := d.Attribute(MarkerAttribute)
+	if !marked {
+		return &HydrationError{Node: n, Msg: "element wasn't rendered by gadget"}
+	}
+	if id != string(el.ID) {
+		return &HydrationError{Node: n, Msg: fmt.Sprintf("found %s %q", MarkerAttribute, id)}
+	}
+	if el.IsComponent() {
+		return nil
+	}
+	return hydrateChildren(nodes, el.Children, d)
+}
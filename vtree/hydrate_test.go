@@ -0,0 +1,234 @@
+package vtree
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeDOM is a DOM parsed from HTML, as the browser would
+type fakeDOM struct {
+	Node
+}
+
+func (f fakeDOM) NodeType() int {
+	switch f.Node.(type) {
+	case *Text:
+		return TextNode
+	case *Comment:
+		return CommentNode
+	}
+	return ElementNode
+}
+
+func (f fakeDOM) TagName() string {
+	return strings.ToUpper(f.Node.(*Element).Type)
+}
+
+func (f fakeDOM) Attribute(name string) (string, bool) {
+	value, ok := f.Node.(*Element).Attributes[name]
+	return value, ok
+}
+
+func (f fakeDOM) NodeValue() string {
+	switch n := f.Node.(type) {
+	case *Text:
+		return n.Text
+	case *Comment:
+		return n.Text
+	}
+	return ""
+}
+
+func (f fakeDOM) ChildNodes() []DOMNode {
+	var res []DOMNode
+	for _, c := range f.Node.(*Element).Children {
+		res = append(res, fakeDOM{c})
+	}
+	return res
+}
+
+func (f fakeDOM) InsertText(text string, before DOMNode) DOMNode {
+	el := f.Node.(*Element)
+	i := len(el.Children)
+	if before != nil {
+		i = f.index(before)
+	}
+	t := &Text{Text: text}
+	el.Children = append(el.Children[:i], append(NodeList{t}, el.Children[i:]...)...)
+	return fakeDOM{t}
+}
+
+func (f fakeDOM) SplitText(child DOMNode, offset int) DOMNode {
+	el := f.Node.(*Element)
+	i := f.index(child)
+	t := el.Children[i].(*Text)
+	rest := &Text{Text: t.Text[offset:]}
+	t.Text = t.Text[:offset]
+	el.Children = append(el.Children[:i+1], append(NodeList{rest}, el.Children[i+1:]...)...)
+	return fakeDOM{rest}
+}
+
+func (f fakeDOM) index(child DOMNode) int {
+	for i, c := range f.Node.(*Element).Children {
+		if c == child.(fakeDOM).Node {
+			return i
+		}
+	}
+	panic("not a child")
+}
+
+func MakeFakeDOM(markup string) fakeDOM {
+	root, err := ParseTemplateOptions("", `<div id="gadget-content">`+markup+`</div>`,
+		ParseOptions{Comments: true, Whitespace: PreserveWhitespace})
+	if err != nil {
+		panic(err)
+	}
+	return fakeDOM{root}
+}
+
+func TestHydrate(t *testing.T) {
+	t.Run("Test server rendered tree", func(t *testing.T) {
+		tree := El("div").C(El("h1").T("a < b"), El("input").A("value", "x"),
+			El("x-child"), Fragment(El("p"), &Comment{Text: "c"}))
+		dom := MakeFakeDOM("\n  " + (&HTMLRenderer{Markers: true}).String(tree) + "\n")
+
+		nodes, err := Hydrate(tree, dom)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		div := dom.ChildNodes()[1]
+		if nodes[tree.ID] != div {
+			t.Errorf("Expected the div to be matched, got %v", nodes[tree.ID])
+		}
+		h1 := div.ChildNodes()[0]
+		if nodes[tree.Children[0].GetID()] != h1 {
+			t.Errorf("Expected the h1 to be matched")
+		}
+		if r := nodes[tree.Children[0].(*Element).Children[0].GetID()]; r != h1.ChildNodes()[0] {
+			t.Errorf("Expected the text to be matched")
+		}
+		fragment := tree.Children[3].(*Element)
+		if nodes[fragment.ID] != div {
+			t.Errorf("Expected the fragment to be the div")
+		}
+		if nodes[fragment.Children[0].GetID()] != div.ChildNodes()[3] {
+			t.Errorf("Expected the fragment's children to be in the div")
+		}
+		if len(nodes) != 8 {
+			t.Errorf("Expected 8 nodes, got %d", len(nodes))
+		}
+	})
+
+	t.Run("Test component content", func(t *testing.T) {
+		content := El("b").SetID("b").T("hi")
+		dom := MakeFakeDOM(`<x-child data-gid="a"><b data-gid="b">hi</b></x-child>`)
+
+		// the content is hydrated when it's added to the component element
+		nodes, err := Hydrate(El("x-child").SetID("a"), dom)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, ok := nodes[content.ID]; ok {
+			t.Errorf("Didn't expect the content to be matched")
+		}
+		if _, err := Hydrate(content, dom.ChildNodes()[0]); err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	})
+
+	render := func(template string) Node {
+		el, err := ParseTemplate("", template)
+		if err != nil {
+			panic(err)
+		}
+		return NewRenderer().Render(el, MakeContext(
+			Variable{"Empty", reflect.ValueOf("")}, Variable{"X", reflect.ValueOf("x")}))[0]
+	}
+
+	TestTexts := map[string]Node{
+		"Empty":             render(`<p g-value="Empty"></p>`),
+		"Around an element": render(`<p>a<span g-value="X"></span>b</p>`),
+		"Around empty":      render(`<p>a<span g-value="Empty"></span>b</p>`),
+		"Adjacent":          El("p").T("a").C(Fragment().T("x").T("")).T("b"),
+		"Textarea":          El("textarea").T("a").T("").T("b"),
+	}
+
+	for Name, Tree := range TestTexts {
+		t.Run("Test text "+Name, func(t *testing.T) {
+			markup := (&HTMLRenderer{Markers: true}).String(Tree)
+			nodes, err := Hydrate(Tree, MakeFakeDOM(markup))
+			if err != nil {
+				t.Fatalf("Unexpected error hydrating %s: %s", markup, err)
+			}
+			// every text has a DOM node, with the same text
+			var check func(n Node)
+			check = func(n Node) {
+				switch node := n.(type) {
+				case *Element:
+					for _, c := range node.Children {
+						check(c)
+					}
+				case *Text:
+					if d, ok := nodes[n.GetID()]; !ok || d.NodeType() != TextNode || d.NodeValue() != node.Text {
+						t.Errorf("Expected text %q to be matched, got %v", node.Text, d)
+					}
+				}
+			}
+			check(Tree)
+		})
+	}
+
+	t.Run("Test joined text", func(t *testing.T) {
+		// markup without separators, the text is split
+		tree := El("p").SetID("a").C(&Text{ID: "t1", Text: "a"}, &Text{ID: "t2", Text: "b"})
+		dom := MakeFakeDOM(`<p data-gid="a">ab</p>`)
+
+		nodes, err := Hydrate(tree, dom)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if nodes["t1"].NodeValue() != "a" || nodes["t2"].NodeValue() != "b" {
+			t.Errorf("Expected the text to be split, got %q %q", nodes["t1"].NodeValue(), nodes["t2"].NodeValue())
+		}
+	})
+
+	TestErrors := map[string]struct {
+		Tree   Node
+		Markup string
+		Err    string
+	}{
+		"Different element": {El("p").SetID("a"), `<div data-gid="a"></div>`,
+			"hydration mismatch at <p> (a): found <div>"},
+		"Different id": {El("p").SetID("a"), `<p data-gid="b"></p>`,
+			`hydration mismatch at <p> (a): found data-gid "b"`},
+		"Different text": {El("p").SetID("a").C(&Text{ID: "t", Text: "new"}), `<p data-gid="a">old</p>`,
+			`hydration mismatch at text "new" (t): found text "old"`},
+		"Missing": {El("ul").SetID("a").C(El("li").SetID("b")), `<ul data-gid="a"></ul>`,
+			"hydration mismatch at <li> (b): no markup found"},
+		"Surplus": {El("ul").SetID("a"), `<ul data-gid="a"><li data-gid="b"></li></ul>`,
+			"hydration mismatch: unexpected <li> in <ul>"},
+		"Not marked": {El("table").SetID("a").C(El("tr").SetID("b")), `<table data-gid="a"><tbody><tr data-gid="b"></tr></tbody></table>`,
+			"hydration mismatch at <tr> (b): found <tbody>"},
+		"No marker": {El("p").SetID("a"), `<p></p>`,
+			"hydration mismatch at <p> (a): element wasn't rendered by gadget"},
+	}
+
+	for Name, TestCase := range TestErrors {
+		t.Run(Name, func(t *testing.T) {
+			nodes, err := Hydrate(TestCase.Tree, MakeFakeDOM(TestCase.Markup))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if _, ok := err.(*HydrationError); !ok {
+				t.Errorf("Expected a *HydrationError, got %T", err)
+			}
+			if err.Error() != TestCase.Err {
+				t.Errorf("Expected error %q, got %q", TestCase.Err, err.Error())
+			}
+			if nodes != nil {
+				t.Errorf("Expected nothing to be hydrated on a mismatch")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package vtree
+
+import (
+	"reflect"
+	"strings"
+)
+
+/*
+ * g-model binds a form control to a value, both ways:
+ *
+ * <input g-model="Name"/>
+ * <input type="checkbox" g-model="Done"/>
+ * <input type="checkbox" value="go" g-model="Tags"/> (Tags is a slice)
+ * <input type="radio" value="small" g-model="Size"/>
+ * <select multiple="multiple" g-model="Selected">..</select>
+ *
+ * Modifiers:
+ * .lazy   - sync on "change" in stead of "input"
+ * .number - convert to a number, if the target doesn't have a type itself
+ * .trim   - trim whitespace
+ */
+
+// ControlState is the state of a form control as read from the DOM
+type ControlState struct {
+	Value   string
+	Checked bool
+	// The values of the selected options of a <select multiple>
+	Values []string
+}
+
+// The kinds of controls g-model distinguishes
+const (
+	TextControl     = "text"
+	CheckboxControl = "checkbox"
+	RadioControl    = "radio"
+	SelectControl   = "select"
+	MultiControl    = "select-multiple"
+)
+
+// ModelModifiers are the modifiers g-model supports
+var ModelModifiers = []string{"lazy", "number", "trim"}
+
+// ParseModelAttribute checks if attr is a g-model (or the older g-bind)
+// attribute and returns its modifiers
+func ParseModelAttribute(attr string) ([]string, bool) {
+	parts := strings.Split(attr, ".")
+	if parts[0] != "g-model" && parts[0] != "g-bind" {
+		return nil, false
+	}
+	return parts[1:], true
+}
+
+// ModelAttribute finds the g-model attribute on an element, if any
+func (el *Element) ModelAttribute() (attr string, modifiers []string, ok bool) {
+	for k := range el.Attributes {
+		if modifiers, ok := ParseModelAttribute(k); ok {
+			return k, modifiers, true
+		}
+	}
+	return "", nil, false
+}
+
+// ControlKind determines what kind of control an element is
+func ControlKind(el *Element) string {
+	switch el.Type {
+	case "select":
+		if _, ok := el.Attributes["multiple"]; ok {
+			return MultiControl
+		}
+		return SelectControl
+	case "input":
+		switch strings.ToLower(el.Attributes["type"]) {
+		case "checkbox":
+			return CheckboxControl
+		case "radio":
+			return RadioControl
+		}
+	}
+	return TextControl
+}
+
+// ModelEvent returns the event that syncs a g-model
+func ModelEvent(el *Element, modifiers []string) string {
+	for _, m := range modifiers {
+		if m == "lazy" {
+			return "change"
+		}
+	}
+	if ControlKind(el) == TextControl {
+		return "input"
+	}
+	return "change"
+}
+
+// optionValue returns the value of an <option>: its value attribute, or
+// its text if it doesn't have one
+func optionValue(option *Element) string {
+	if v, ok := option.Attributes["value"]; ok {
+		return v
+	}
+	text := ""
+	for _, c := range option.Children {
+		if t, ok := c.(*Text); ok {
+			text += t.Text
+		}
+	}
+	return strings.TrimSpace(text)
+}
+
+// modelContains checks if value equals s, or, if value is a collection,
+// if it contains s
+func modelContains(value reflect.Value, s string) bool {
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			if Stringify(value.Index(i)) == s {
+				return true
+			}
+		}
+		return false
+	case reflect.Invalid:
+		return false
+	}
+	return Stringify(value) == s
+}
+
+// RenderModel reflects the g-model's value on the control: the value of
+// inputs, the checked state of checkboxes and radio buttons and the
+// selected options of a select. The g-model attribute itself remains, so
+// the component can bind it.
+func (r *Renderer) RenderModel(e *Element, expression string, context *Context) {
+	value := r.eval("g-model", expression, context)
+
+	switch ControlKind(e) {
+	case CheckboxControl:
+		checked := false
+		if v := indirect(value); v.Kind() == reflect.Bool {
+			checked = v.Bool()
+		} else {
+			checked = modelContains(value, e.Attributes["value"])
+		}
+		setBooleanAttribute(e, "checked", checked)
+	case RadioControl:
+		setBooleanAttribute(e, "checked", value != NotFound && Stringify(value) == e.Attributes["value"])
+	case SelectControl, MultiControl:
+		r.selectOptions(e.Children, value)
+	default:
+		e.Attributes["value"] = Stringify(value)
+	}
+}
+
+// selectOptions marks the (possibly nested in <optgroup>) options that match value
+func (r *Renderer) selectOptions(children NodeList, value reflect.Value) {
+	for _, c := range children {
+		el, ok := c.(*Element)
+		if !ok {
+			continue
+		}
+		if el.Type == "option" {
+			setBooleanAttribute(el, "selected", modelContains(value, optionValue(el)))
+		} else {
+			r.selectOptions(el.Children, value)
+		}
+	}
+}
+
+func setBooleanAttribute(e *Element, attr string, value bool) {
+	if value {
+		e.Attributes[attr] = attr
+	} else {
+		delete(e.Attributes, attr)
+	}
+}
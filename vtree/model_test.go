@@ -0,0 +1,112 @@
+package vtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseModelAttribute(t *testing.T) {
+	TestCases := map[string]struct {
+		Attr      string
+		Ok        bool
+		Modifiers []string
+	}{
+		"Plain":          {"g-model", true, []string{}},
+		"Modifiers":      {"g-model.lazy.trim", true, []string{"lazy", "trim"}},
+		"Legacy g-bind":  {"g-bind", true, []string{}},
+		"Bind attribute": {"g-bind:href", false, nil},
+		"Other":          {"g-value", false, nil},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			modifiers, ok := ParseModelAttribute(TestCase.Attr)
+			if ok != TestCase.Ok {
+				t.Fatalf("Expected ok to be %v", TestCase.Ok)
+			}
+			if ok && !reflect.DeepEqual(modifiers, TestCase.Modifiers) {
+				t.Errorf("Expected modifiers %v, got %v", TestCase.Modifiers, modifiers)
+			}
+		})
+	}
+}
+
+func TestModelEvent(t *testing.T) {
+	TestCases := map[string]struct {
+		El       *Element
+		Expected string
+	}{
+		"Text input":      {El("input").A("g-model", "Name"), "input"},
+		"Lazy text input": {El("input").A("g-model.lazy", "Name"), "change"},
+		"Textarea":        {El("textarea").A("g-model", "Name"), "input"},
+		"Checkbox":        {El("input").A("type", "checkbox").A("g-model", "Done"), "change"},
+		"Radio":           {El("input").A("type", "RADIO").A("g-model", "Size"), "change"},
+		"Select":          {El("select").A("g-model", "Size"), "change"},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			bindings := TestCase.El.EventBindings()
+			if len(bindings) != 1 {
+				t.Fatalf("Expected a single binding, got %d", len(bindings))
+			}
+			if bindings[0].Event != TestCase.Expected {
+				t.Errorf("Expected g-model to bind to %s, got %s", TestCase.Expected, bindings[0].Event)
+			}
+		})
+	}
+}
+
+func TestRenderModel(t *testing.T) {
+	render := func(e *Element) *Element {
+		ctx := &Context{}
+		ctx.Push("name", "gadget")
+		ctx.Push("done", true)
+		ctx.Push("tags", []string{"go", "wasm"})
+		ctx.Push("size", 2)
+		return NewRenderer().Render(e, ctx)[0]
+	}
+
+	t.Run("Test text input value", func(t *testing.T) {
+		res := render(El("input").A("g-model", "name"))
+		AssertAttribute(t, res, "value", "gadget")
+		AssertAttribute(t, res, "g-model", "name")
+	})
+
+	t.Run("Test bool checkbox", func(t *testing.T) {
+		res := render(El("input").A("type", "checkbox").A("g-model", "done"))
+		AssertAttribute(t, res, "checked", "checked")
+	})
+
+	t.Run("Test checkbox in slice", func(t *testing.T) {
+		AssertAttribute(t, render(El("input").A("type", "checkbox").A("value", "go").A("g-model", "tags")), "checked", "checked")
+		AssertAttributeNotPresent(t, render(El("input").A("type", "checkbox").A("value", "js").A("g-model", "tags")), "checked")
+	})
+
+	t.Run("Test radio", func(t *testing.T) {
+		AssertAttribute(t, render(El("input").A("type", "radio").A("value", "2").A("g-model", "size")), "checked", "checked")
+		AssertAttributeNotPresent(t, render(El("input").A("type", "radio").A("value", "3").A("g-model", "size")), "checked")
+	})
+
+	t.Run("Test select", func(t *testing.T) {
+		res := render(El("select").A("g-model", "size").C(
+			El("option").A("value", "1"),
+			El("option").A("g-for", "i in 3").A("g-value", "i"),
+		))
+		AssertAttributeNotPresent(t, res.Children[0].(*Element), "selected")
+		AssertAttributeNotPresent(t, res.Children[1].(*Element), "selected")
+		AssertAttributeNotPresent(t, res.Children[2].(*Element), "selected")
+		AssertAttribute(t, res.Children[3].(*Element), "selected", "selected")
+	})
+
+	t.Run("Test multiple select", func(t *testing.T) {
+		res := render(El("select").A("multiple", "multiple").A("g-model", "tags").C(
+			El("optgroup").C(El("option").T("go"), El("option").T("js")),
+			El("option").T("wasm"),
+		))
+		group := res.Children[0].(*Element)
+		AssertAttribute(t, group.Children[0].(*Element), "selected", "selected")
+		AssertAttributeNotPresent(t, group.Children[1].(*Element), "selected")
+		AssertAttribute(t, res.Children[1].(*Element), "selected", "selected")
+	})
+}
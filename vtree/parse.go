@@ -1,74 +1,571 @@
 package vtree
 
 import (
-	"bytes"
-	"encoding/xml"
 	"fmt"
-	"io"
+	"html"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+/*
+ * Templates are parsed as HTML (not XML), with a small tokenizer of its own:
+ *
+ * - void elements like <input> and <br> don't need to be closed
+ * - <x-comp/> closes any element
+ * - attributes without value (disabled, g-else) are kept, with value ""
+ * - character references (&amp;, &#8364;) are decoded in text and attributes
+ * - the contents of <script> and <style> are kept as is, those of <textarea>
+ *   and <title> are only decoded
+ * - comments are dropped, or kept as Comment nodes
+ * - whitespace is condensed (see Whitespace), except in <pre> and raw text
+ *
+ * Some things HTML is lenient about are errors, since they're probably
+ * mistakes in a template: unclosed tags, stray end tags and a '<' that
+ * doesn't start a tag (use &lt;).
+ */
+
+// Whitespace determines what happens to whitespace in a template's text
+type Whitespace int
+
+const (
+	// CondenseWhitespace drops whitespace-only text that contains a newline
+	// (e.g. the indentation between elements) and collapses other runs of
+	// whitespace into a single space
+	CondenseWhitespace Whitespace = iota
+	// PreserveWhitespace keeps text as is
+	PreserveWhitespace
+)
+
+// ParseOptions configures how a template is parsed. The zero value drops
+// comments and condenses whitespace
+type ParseOptions struct {
+	Comments   bool // keep comments as Comment nodes
+	Whitespace Whitespace
+	IDs        *IDSource // where elements get their ids, El's if nil
+}
+
+// voidElements never have content or an end tag
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements contain text only, up to their end tag. The value tells
+// if character references are decoded
+var rawTextElements = map[string]bool{
+	"script": false, "style": false, "textarea": true, "title": true,
+}
+
+// A ParseError is an error in a template, at the position it was found
+type ParseError struct {
+	Template string // the template's name, e.g. the component's
+	Line     int
+	Column   int
+	Snippet  string // the line of the template the error is on
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	name := e.Template
+	if name == "" {
+		name = "template"
+	}
+	msg := fmt.Sprintf("%s:%d:%d: %s", name, e.Line, e.Column, e.Msg)
+	if e.Snippet == "" {
+		return msg
+	}
+	// point at the column, keeping tabs so it lines up
+	var caret strings.Builder
+	for i, c := range e.Snippet {
+		if utf8.RuneCountInString(e.Snippet[:i]) >= e.Column-1 {
+			break
+		}
+		if c == '\t' {
+			caret.WriteRune(c)
+		} else {
+			caret.WriteRune(' ')
+		}
+	}
+	return msg + "\n\t" + e.Snippet + "\n\t" + caret.String() + "^"
+}
+
+// directives are the g- attributes the renderer understands. Events
+// (g-on:, g-click), g-model and g-bind:attr are checked separately
+var directives = []string{
+	"g-value", "g-if", "g-else", "g-else-if", "g-for", "g-key", "g-class",
+	"g-model", "g-bind", "g-on", "g-slot",
+}
+
+// checkDirective returns an error for g- attributes that aren't directives,
+// suggesting the one that was probably meant, and for unknown event modifiers
+func checkDirective(attr string) error {
+	if b, ok := ParseEventAttribute(attr); ok {
+		return b.Check()
+	}
+	if !strings.HasPrefix(attr, "g-") {
+		return nil
+	}
+	if _, ok := ParseModelAttribute(attr); ok {
+		return nil
+	}
+	name := attr
+	if i := strings.IndexAny(attr, ":."); i != -1 {
+		name = attr[:i]
+		if (name == "g-bind" || name == "g-slot") && attr[i] == ':' && i+1 < len(attr) {
+			return nil
+		}
+	}
+	for _, d := range directives {
+		if d == attr && d != "g-on" {
+			return nil
+		}
+	}
+
+	best, distance := "", 3
+	for _, d := range directives {
+		if dist := editDistance(name, d); dist < distance {
+			best, distance = d, dist
+		}
+	}
+	if best != "" && best != name {
+		return fmt.Errorf("unknown directive %s, did you mean %s?", attr, best)
+	}
+	return fmt.Errorf("unknown directive %s", attr)
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// Parse parses a template that's known to be valid, it panics on errors.
+// Use ParseTemplate for templates that may contain errors
 func Parse(s string) *Element {
-	dec := xml.NewDecoder(bytes.NewBuffer([]byte(s)))
+	el, err := ParseTemplate("", s)
+	if err != nil {
+		panic(err)
+	}
+	return el
+}
 
-	dec.Entity = xml.HTMLEntity
-	dec.Strict = false
-	dec.AutoClose = xml.HTMLAutoClose
+/*
+ * ParseTemplate parses a template into a tree, with the default options.
+ * If it doesn't consist of a single element, the top-level nodes are
+ * returned in a fragment (which may be empty).
+ *
+ * Errors are *ParseErrors, with the position in the template. Besides
+ * syntax errors, unknown g- directives, unclosed tags and duplicate ids
+ * are reported. name is used to identify the template in errors.
+ */
+func ParseTemplate(name string, s string) (*Element, error) {
+	return ParseTemplateOptions(name, s, ParseOptions{})
+}
 
-	var root *Element
-	var current *Element
-	// initialize with the toplevel parent nil, so we can properly "pop" it at the end
+// ParseTemplateOptions is ParseTemplate, with options
+func ParseTemplateOptions(name string, s string, options ParseOptions) (*Element, error) {
+	p := &parser{name: name, src: s, options: options, ids: make(map[string]int)}
+	top := p.options.IDs.Fragment()
+	p.stack = []*open{{el: top}}
 
-	parents := []*Element{nil}
+	for p.pos < len(s) {
+		var err error
 
-	for {
-		token, err := dec.Token()
+		switch {
+		case strings.HasPrefix(s[p.pos:], "<!--"):
+			err = p.comment()
+		case strings.HasPrefix(s[p.pos:], "<!") || strings.HasPrefix(s[p.pos:], "<?"):
+			// <!DOCTYPE> and the like have no meaning in a template
+			err = p.skipTag()
+		case strings.HasPrefix(s[p.pos:], "</"):
+			err = p.endTag()
+		case s[p.pos] == '<':
+			err = p.startTag()
+		default:
+			p.text()
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			panic(err)
+			return nil, err
+		}
+	}
+	if len(p.stack) > 1 {
+		o := p.stack[len(p.stack)-1]
+		return nil, p.errorAt(o.offset, "unclosed <%s>", o.el.Type)
+	}
+
+	if len(top.Children) == 1 {
+		if root, ok := top.Children[0].(*Element); ok {
+			return root, nil
 		}
+	}
+	return top, nil
+}
+
+// parser tokenizes a template and builds its tree
+type parser struct {
+	name    string
+	src     string
+	pos     int
+	options ParseOptions
+	stack   []*open        // the elements being parsed, the fragment first
+	ids     map[string]int // offsets of ids seen
+}
 
-		switch token.(type) {
-		case xml.StartElement: // <li> and <my-component>
-			element := token.(xml.StartElement)
-			name := element.Name.Local
+// open is an element that hasn't been closed (yet) while parsing
+type open struct {
+	el     *Element
+	offset int // where its start tag is
+}
+
+func (p *parser) current() *Element {
+	return p.stack[len(p.stack)-1].el
+}
+
+func (p *parser) errorAt(offset int, format string, args ...interface{}) *ParseError {
+	if offset > len(p.src) {
+		offset = len(p.src)
+	}
+	start := strings.LastIndex(p.src[:offset], "\n") + 1
+	end := strings.Index(p.src[offset:], "\n")
+	if end == -1 {
+		end = len(p.src)
+	} else {
+		end += offset
+	}
+	return &ParseError{
+		Template: p.name,
+		Line:     strings.Count(p.src[:offset], "\n") + 1,
+		Column:   utf8.RuneCountInString(p.src[start:offset]) + 1,
+		Snippet:  strings.TrimRight(p.src[start:end], "\r"),
+		Msg:      fmt.Sprintf(format, args...),
+	}
+}
+
+// position returns the line and column of an offset
+func (p *parser) position(offset int) (int, int) {
+	err := p.errorAt(offset, "")
+	return err.Line, err.Column
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && isSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+// readName reads a tag or attribute name, up to whitespace or one of stop
+func (p *parser) readName(stop string) string {
+	start := p.pos
+	for p.pos < len(p.src) && !isSpace(p.src[p.pos]) && strings.IndexByte(stop, p.src[p.pos]) == -1 {
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
 
-			if root == nil {
-				root = El(name)
-				current = root
-			} else {
-				parents = append([]*Element{current}, parents...)
-				current = El(name)
-				parents[0].C(current)
+// inPre tells if whitespace must be kept as is
+func (p *parser) inPre() bool {
+	if p.options.Whitespace == PreserveWhitespace {
+		return true
+	}
+	for _, o := range p.stack {
+		if strings.EqualFold(o.el.Type, "pre") {
+			return true
+		}
+	}
+	return false
+}
+
+// text reads text up to the next tag
+func (p *parser) text() {
+	end := strings.IndexByte(p.src[p.pos:], '<')
+	if end == -1 {
+		end = len(p.src)
+	} else {
+		end += p.pos
+	}
+	text := p.src[p.pos:end]
+	p.pos = end
+
+	current := p.current()
+	blank := strings.TrimSpace(text) == ""
+
+	// whitespace around and between top-level elements never matters
+	if blank && len(p.stack) == 1 {
+		return
+	}
+	if !p.inPre() {
+		if blank && strings.Contains(text, "\n") {
+			return
+		}
+		text = collapseSpace(text)
+	}
+	text = html.UnescapeString(text)
+	current.T(text)
+}
+
+// collapseSpace replaces each run of whitespace with a single space
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if isSpace(s[i]) {
+			if !space {
+				b.WriteByte(' ')
 			}
-			for _, attr := range element.Attr {
-				attrName := attr.Name.Local
-				if strings.HasPrefix(attr.Name.Space, "g-") {
-					attrName = attr.Name.Space + ":" + attr.Name.Local
-				}
-				current.A(attrName, attr.Value)
-				// not sure what to do with this...
-				if attr.Name.Local == "id" {
-					current.SetID(ElementID(attr.Value))
-				}
+			space = true
+			continue
+		}
+		b.WriteByte(s[i])
+		space = false
+	}
+	return b.String()
+}
+
+// comment reads <!-- ... -->
+func (p *parser) comment() error {
+	start := p.pos
+	end := strings.Index(p.src[p.pos+len("<!--"):], "-->")
+	if end == -1 {
+		return p.errorAt(start, "unclosed comment")
+	}
+	end += p.pos + len("<!--")
+	text := p.src[p.pos+len("<!--") : end]
+	p.pos = end + len("-->")
+
+	if p.options.Comments {
+		current := p.current()
+		current.C(&Comment{ID: ElementID(string(current.ID) + "c" + strconv.Itoa(len(current.Children))), Text: text})
+	}
+	return nil
+}
+
+// skipTag skips a tag that isn't an element, e.g. <!DOCTYPE html>
+func (p *parser) skipTag() error {
+	end := strings.IndexByte(p.src[p.pos:], '>')
+	if end == -1 {
+		return p.errorAt(p.pos, "unexpected end of template in tag")
+	}
+	p.pos += end + 1
+	return nil
+}
+
+// endTag reads </name> and closes the element
+func (p *parser) endTag() error {
+	start := p.pos
+	p.pos += len("</")
+	name := p.readName(">")
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != '>' {
+		return p.errorAt(start, "expected > after </%s", name)
+	}
+	p.pos++
+
+	if name == "" {
+		return p.errorAt(start, "expected element name after </")
+	}
+	top := p.stack[len(p.stack)-1]
+	if strings.EqualFold(top.el.Type, name) && len(p.stack) > 1 {
+		p.stack = p.stack[:len(p.stack)-1]
+		return nil
+	}
+	if voidElements[strings.ToLower(name)] {
+		// </br> and the like are harmless
+		return nil
+	}
+	for _, o := range p.stack[1:] {
+		if strings.EqualFold(o.el.Type, name) {
+			return p.errorAt(top.offset, "unclosed <%s>", top.el.Type)
+		}
+	}
+	return p.errorAt(start, "unexpected end tag </%s>", name)
+}
+
+// attribute is an attribute as found in a start tag
+type attribute struct {
+	name   string
+	value  string
+	offset int
+}
+
+// startTag reads <name attr="value"...> and opens the element, unless
+// it's void or self-closing
+func (p *parser) startTag() error {
+	start := p.pos
+	p.pos++
+	name := p.readName("/>\"'=<")
+	if name == "" {
+		return p.errorAt(start, "expected element name after <")
+	}
+
+	var attrs []attribute
+	selfClosing := false
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return p.errorAt(start, "unexpected end of template in <%s>", name)
+		}
+		if p.src[p.pos] == '>' {
+			p.pos++
+			break
+		}
+		if strings.HasPrefix(p.src[p.pos:], "/>") {
+			p.pos += 2
+			selfClosing = true
+			break
+		}
+		if p.src[p.pos] == '/' {
+			p.pos++
+			continue
+		}
+
+		attrStart := p.pos
+		attrName := p.readName("/>=\"'")
+		if attrName == "" {
+			return p.errorAt(p.pos, "unexpected %q in <%s>", p.src[p.pos], name)
+		}
+		value := ""
+		p.skipSpace()
+		if p.pos < len(p.src) && p.src[p.pos] == '=' {
+			p.pos++
+			p.skipSpace()
+			v, err := p.attributeValue(attrStart)
+			if err != nil {
+				return err
 			}
+			value = v
+		}
+		attrs = append(attrs, attribute{name: attrName, value: value, offset: attrStart})
+	}
 
-		case xml.EndElement: // </li>
-			current, parents = parents[0], parents[1:]
-		case xml.CharData:
-			// ignore (whitespace) data before first actual tag
-			if current != nil {
-				b := token.(xml.CharData).Copy()
-				current.T(string(b))
-				// fmt.Printf("text: %s\n", string(b))
+	el := p.options.IDs.El(name)
+	for _, attr := range attrs {
+		// @event is shorthand for g-on:event
+		if strings.HasPrefix(attr.name, "@") {
+			attr.name = "g-on:" + attr.name[1:]
+		}
+		if err := checkDirective(attr.name); err != nil {
+			return p.errorAt(attr.offset, "%s", err)
+		}
+		el.A(attr.name, attr.value)
+		if attr.name == "id" {
+			if first, ok := p.ids[attr.value]; ok {
+				line, column := p.position(first)
+				return p.errorAt(attr.offset, "duplicate id %q, already used at %d:%d", attr.value, line, column)
 			}
-		case xml.Comment:
-			fmt.Println("It's a comment")
-			// ProcInst, Directive?
+			p.ids[attr.value] = attr.offset
+			el.SetID(ElementID(attr.value))
+		}
+	}
+	p.current().C(el)
+
+	lower := strings.ToLower(name)
+	if selfClosing || voidElements[lower] {
+		return nil
+	}
+	if decode, ok := rawTextElements[lower]; ok {
+		return p.rawText(el, start, decode)
+	}
+	p.stack = append(p.stack, &open{el: el, offset: start})
+	return nil
+}
+
+// attributeValue reads a quoted or unquoted attribute value
+func (p *parser) attributeValue(attrStart int) (string, error) {
+	if p.pos >= len(p.src) {
+		return "", p.errorAt(attrStart, "expected attribute value")
+	}
+	if q := p.src[p.pos]; q == '"' || q == '\'' {
+		end := strings.IndexByte(p.src[p.pos+1:], q)
+		if end == -1 {
+			return "", p.errorAt(p.pos, "unclosed quote in attribute value")
+		}
+		value := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return html.UnescapeString(value), nil
+	}
+	value := p.readName(">")
+	return html.UnescapeString(value), nil
+}
+
+// rawText reads the contents of e.g. <script> up to its end tag
+// indexEndTag returns the index of the end tag of name in s, or -1. Like
+// in HTML, names match ASCII case-insensitively: lowering s could change
+// its length, and e.g. "ſ" would match "s"
+func indexEndTag(s, name string) int {
+	closing := "</" + name
+	for i := 0; ; i += 2 {
+		j := strings.Index(s[i:], "</")
+		if j == -1 {
+			return -1
+		}
+		i += j
+		if len(s)-i >= len(closing) && asciiEqualFold(s[i:i+len(closing)], closing) {
+			return i
+		}
+	}
+}
+
+func asciiEqualFold(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		ca, cb := a[i], b[i]
+		if 'A' <= ca && ca <= 'Z' {
+			ca += 'a' - 'A'
+		}
+		if 'A' <= cb && cb <= 'Z' {
+			cb += 'a' - 'A'
+		}
+		if ca != cb {
+			return false
 		}
 	}
+	return true
+}
 
-	return root
+func (p *parser) rawText(el *Element, start int, decode bool) error {
+	end := indexEndTag(p.src[p.pos:], el.Type)
+	if end == -1 {
+		return p.errorAt(start, "unclosed <%s>", el.Type)
+	}
+	end += p.pos
+	text := p.src[p.pos:end]
+	if decode {
+		text = html.UnescapeString(text)
+	}
+	if text != "" {
+		el.T(text)
+	}
+	p.pos = end
+	// the end tag closes it, like any other element
+	p.stack = append(p.stack, &open{el: el, offset: start})
+	return nil
 }
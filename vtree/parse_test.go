@@ -67,3 +67,239 @@ func TestSplitTextParse(t *testing.T) {
 
 // 	AssertComponentNode(t, el.Children[0], "my-component")
 // }
+
+func TestValuelessAttributeParse(t *testing.T) {
+	el := Parse(`<div><p g-if="a"></p><p g-else></p></div>`)
+
+	if _, ok := el.Children[1].(*Element).Attributes["g-else"]; !ok {
+		t.Error("Expected g-else attribute to be present")
+	}
+}
+
+func TestEventShorthandParse(t *testing.T) {
+	el := Parse(`<div @click="doit" title="mail @home"><input @keydown="key"/></div>`)
+
+	AssertElementAttributes(t, el, Attributes{"title": "mail @home"})
+	AssertAttribute(t, el, "g-on:click", "doit")
+	AssertAttribute(t, el.Children[0].(*Element), "g-on:keydown", "key")
+}
+
+func TestParseIDs(t *testing.T) {
+	Parse := func() *Element {
+		el, err := ParseTemplateOptions("x-ids", "<div><p>a</p><p>b</p></div>", ParseOptions{IDs: &IDSource{Prefix: "x"}})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		return el
+	}
+	one, other := Parse(), Parse()
+
+	// the fragment around the root got x1
+	if one.ID != "x2" || one.Children[1].GetID() != "x4" {
+		t.Errorf("Expected ids from the IDSource, got %s and %s", one.ID, one.Children[1].GetID())
+	}
+	if one.ID != other.ID || one.Children[1].GetID() != other.Children[1].GetID() {
+		t.Errorf("Expected the same ids from a new IDSource")
+	}
+}
+
+func TestFragmentParse(t *testing.T) {
+	t.Run("Test several roots", func(t *testing.T) {
+		el := Parse("\n<h1>Title</h1>\n<p>Text</p>\n")
+
+		AssertElement(t, el, FragmentType)
+		if len(el.Children) != 2 {
+			t.Fatalf("Expected 2 roots, got %d", len(el.Children))
+		}
+		AssertElement(t, el.Children[0].(*Element), "h1")
+		AssertElement(t, el.Children[1].(*Element), "p")
+	})
+
+	t.Run("Test text root", func(t *testing.T) {
+		el := Parse("Hello <b>World</b>")
+
+		AssertElement(t, el, FragmentType)
+		AssertTextNode(t, el.Children[0], "Hello ")
+	})
+
+	t.Run("Test empty", func(t *testing.T) {
+		el := Parse("  ")
+
+		AssertElement(t, el, FragmentType)
+		if len(el.Children) != 0 {
+			t.Errorf("Expected no roots, got %d", len(el.Children))
+		}
+	})
+
+	t.Run("Test single root", func(t *testing.T) {
+		AssertElement(t, Parse("  <div></div>  "), "div")
+	})
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	TestCases := map[string]struct {
+		Template string
+		Line     int
+		Column   int
+		Msg      string
+	}{
+		"Syntax":              {"<div>\n  <\n</div>", 2, 3, "expected element name after <"},
+		"Unclosed tag":        {"<div>\n  <p>text\n</div>", 2, 3, "unclosed <p>"},
+		"Unclosed at end":     {"<div><input>\n  <b>", 2, 3, "unclosed <b>"},
+		"Unknown directive":   {"<div>\n  <li g-fro=\"i in items\"></li>\n</div>", 2, 7, "unknown directive g-fro, did you mean g-for?"},
+		"Unknown, no match":   {`<div g-whatever="x"></div>`, 1, 6, "unknown directive g-whatever"},
+		"Misspelled binding":  {`<div g-bnd:href="x"></div>`, 1, 6, "unknown directive g-bnd:href, did you mean g-bind?"},
+		"After shorthand":     {`<div @click="a" g-iff="b"></div>`, 1, 17, "unknown directive g-iff, did you mean g-if?"},
+		"Unknown modifier":    {`<div @click.capture="a"></div>`, 1, 6, "unknown modifier capture in g-on:click.capture"},
+		"Misspelled key":      {`<input g-on:keydown.entr="a">`, 1, 8, "unknown modifier entr in g-on:keydown.entr"},
+		"Key filter on click": {`<div g-on:click.enter="a"></div>`, 1, 6, "key filter enter in g-on:click.enter only applies to key events"},
+		"Duplicate id":        {"<div id=\"a\">\n  <p id=\"a\"></p>\n</div>", 2, 6, `duplicate id "a", already used at 1:6`},
+		"Stray end tag":       {"<div></p></div>", 1, 6, "unexpected end tag </p>"},
+	}
+
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			_, err := ParseTemplate("x-test", TestCase.Template)
+			pe, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("Expected a *ParseError, got %#v", err)
+			}
+			if pe.Template != "x-test" || pe.Line != TestCase.Line || pe.Column != TestCase.Column || pe.Msg != TestCase.Msg {
+				t.Errorf("Expected x-test:%d:%d: %s, got %s:%d:%d: %s", TestCase.Line, TestCase.Column, TestCase.Msg,
+					pe.Template, pe.Line, pe.Column, pe.Msg)
+			}
+		})
+	}
+
+	t.Run("Test error message", func(t *testing.T) {
+		_, err := ParseTemplate("x-list", "<ul>\n\t<li g-fro=\"i in items\"></li>\n</ul>")
+		expected := "x-list:2:6: unknown directive g-fro, did you mean g-for?\n\t\t<li g-fro=\"i in items\"></li>\n\t\t    ^"
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error %q, got %v", expected, err)
+		}
+	})
+
+	t.Run("Test valid directives", func(t *testing.T) {
+		_, err := ParseTemplate("x-test", `<div g-if="a" g-class="c" :title="t" g-bind:href="h" @click.prevent="x">`+
+			`<input g-model.lazy="v"/><b g-else-if="b" g-key="k" g-value="v"></b><i g-else></i>`+
+			`<template g-slot:row="props"></template><x-list g-on:saved="s"></x-list></div>`)
+		if err != nil {
+			t.Errorf("Unexpected error: %s", err)
+		}
+	})
+
+	t.Run("Test comments are ignored", func(t *testing.T) {
+		el, err := ParseTemplate("x-test", `<div><!-- a comment --><p></p></div>`)
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if len(el.Children) != 1 {
+			t.Errorf("Expected only the <p>, got %d children", len(el.Children))
+		}
+	})
+}
+
+func TestHTMLParse(t *testing.T) {
+	t.Run("Test void elements", func(t *testing.T) {
+		el := Parse(`<div><input type="text"><br><p>text</p></div>`)
+
+		if len(el.Children) != 3 {
+			t.Fatalf("Expected 3 children, got %d", len(el.Children))
+		}
+		AssertElement(t, el.Children[2].(*Element), "p")
+	})
+
+	t.Run("Test self-closing", func(t *testing.T) {
+		el := Parse(`<div><x-comp/><p></p></div>`)
+
+		if len(el.Children) != 2 {
+			t.Fatalf("Expected 2 children, got %d", len(el.Children))
+		}
+	})
+
+	t.Run("Test boolean attributes", func(t *testing.T) {
+		el := Parse(`<input disabled type=checkbox checked>`)
+
+		AssertElementAttributes(t, el, Attributes{"disabled": "", "type": "checkbox", "checked": ""})
+	})
+
+	t.Run("Test character references", func(t *testing.T) {
+		el := Parse(`<p title="a &amp; b">&lt;b&gt; &euro;&#33;</p>`)
+
+		AssertAttribute(t, el, "title", "a & b")
+		AssertTextNode(t, el.Children[0], "<b> €!")
+	})
+
+	t.Run("Test raw text", func(t *testing.T) {
+		el := Parse("<div><script>if (a < b && c > d) { x = '</p>' }</script><style>p > b { }</style></div>")
+
+		AssertTextNode(t, el.Children[0].(*Element).Children[0], "if (a < b && c > d) { x = '</p>' }")
+		AssertTextNode(t, el.Children[1].(*Element).Children[0], "p > b { }")
+	})
+
+	t.Run("Test raw text end tag", func(t *testing.T) {
+		// lowering Ⱥ makes it longer, ſ folds to s
+		el := Parse("<div><script>x = 'ȺȺ</ſcript>'</SCRIPT><p>a</p></div>")
+
+		AssertTextNode(t, el.Children[0].(*Element).Children[0], "x = 'ȺȺ</ſcript>'")
+		if r := el.Children[1].ToString(); r != "<p>a</p>" {
+			t.Errorf("Expected the script to end at its end tag, got %s", r)
+		}
+	})
+
+	t.Run("Test escapable raw text", func(t *testing.T) {
+		el := Parse("<textarea><b>&amp;</b></textarea>")
+
+		AssertTextNode(t, el.Children[0], "<b>&</b>")
+	})
+
+	t.Run("Test comments", func(t *testing.T) {
+		tpl := `<div><p g-if="a">a</p><!-- or else --><p g-else>b</p></div>`
+
+		if el := Parse(tpl); len(el.Children) != 2 {
+			t.Errorf("Expected comments to be dropped, got %d children", len(el.Children))
+		}
+
+		el, err := ParseTemplateOptions("x-test", tpl, ParseOptions{Comments: true})
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if r := el.Children[1].ToString(); r != "<!-- or else -->" {
+			t.Errorf("Expected the comment to be kept, got %s", r)
+		}
+
+		// A comment doesn't break the g-if/g-else chain
+		ctx := &Context{}
+		ctx.Push("a", false)
+		if r := NewRenderer().Render(el, ctx)[0].ToString(); r != "<div><!-- or else --><p>b</p></div>" {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test condensed whitespace", func(t *testing.T) {
+		el := Parse("<ul>\n  <li>a</li>\n  <li>b   \n c</li>\n</ul>")
+
+		if len(el.Children) != 2 {
+			t.Fatalf("Expected indentation to be dropped, got %d children", len(el.Children))
+		}
+		AssertTextNode(t, el.Children[1].(*Element).Children[0], "b c")
+
+		el = Parse("<p><b>a</b> <i>b</i></p>")
+		AssertTextNode(t, el.Children[1], " ")
+	})
+
+	t.Run("Test pre keeps whitespace", func(t *testing.T) {
+		el := Parse("<pre>  a\n  <b> b </b></pre>")
+
+		AssertTextNode(t, el.Children[0], "  a\n  ")
+		AssertTextNode(t, el.Children[1].(*Element).Children[0], " b ")
+	})
+
+	t.Run("Test preserved whitespace", func(t *testing.T) {
+		el, _ := ParseTemplateOptions("x-test", "<ul>\n  <li>a</li>\n</ul>", ParseOptions{Whitespace: PreserveWhitespace})
+
+		if len(el.Children) != 3 {
+			t.Errorf("Expected whitespace to be kept, got %d children", len(el.Children))
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package vtree
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/*
+ * A Path addresses a value inside another value, e.g.
+ *
+ * Address.City
+ * Items[0].Title
+ * Settings["theme"]
+ *
+ * Fields of embedded structs can be used directly, like in Go. Pointers and
+ * interfaces are followed. Unlike expressions, paths can be written to
+ * (see Set), which is what g-model needs.
+ */
+type Path []PathStep
+
+// A PathStep is a field (or map key) or an index
+type PathStep struct {
+	Name  string
+	Index bool // Name is the key in [], an int or an unquoted string
+}
+
+// PathError describes a path that can't be parsed or resolved
+type PathError struct {
+	Path string
+	Msg  string
+}
+
+func (e *PathError) Error() string {
+	return fmt.Sprintf("%s (in path %q)", e.Msg, e.Path)
+}
+
+// ParsePath parses e.g. Items[0].Title into a Path
+func ParsePath(s string) (Path, error) {
+	var p Path
+	rest := s
+	for first := true; rest != "" || first; first = false {
+		switch {
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end == -1 {
+				return nil, &PathError{s, "missing ]"}
+			}
+			key := strings.TrimSpace(rest[1:end])
+			if unquoted, err := strconv.Unquote(key); err == nil {
+				key = unquoted
+			} else if _, err := strconv.Atoi(key); err != nil {
+				return nil, &PathError{s, fmt.Sprintf("bad index %s", key)}
+			}
+			p = append(p, PathStep{Name: key, Index: true})
+			rest = rest[end+1:]
+			continue
+		case !first && strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case !first:
+			return nil, &PathError{s, fmt.Sprintf("unexpected %q", rest[:1])}
+		}
+		end := strings.IndexAny(rest, ".[")
+		if end == -1 {
+			end = len(rest)
+		}
+		if !isIdentifier(rest[:end]) {
+			return nil, &PathError{s, fmt.Sprintf("bad name %q", rest[:end])}
+		}
+		p = append(p, PathStep{Name: rest[:end]})
+		rest = rest[end:]
+	}
+	return p, nil
+}
+
+func (p Path) String() string {
+	var b strings.Builder
+	for i, step := range p {
+		switch {
+		case !step.Index && i > 0:
+			b.WriteString("." + step.Name)
+		case !step.Index:
+			b.WriteString(step.Name)
+		case isNumber(step.Name):
+			b.WriteString("[" + step.Name + "]")
+		default:
+			b.WriteString("[" + strconv.Quote(step.Name) + "]")
+		}
+	}
+	return b.String()
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+func (p Path) error(format string, args ...interface{}) error {
+	return &PathError{p.String(), fmt.Sprintf(format, args...)}
+}
+
+// field finds a field, also of an embedded struct. An embedded pointer
+// that's nil is an error in stead of a panic
+func (p Path) field(v reflect.Value, name string) (reflect.Value, error) {
+	sf, ok := v.Type().FieldByName(name)
+	if !ok {
+		return NotFound, p.error("%s has no field %s", v.Type(), name)
+	}
+	if sf.PkgPath != "" {
+		return NotFound, p.error("field %s of %s is unexported", name, v.Type())
+	}
+	f, nilPtr := fieldByIndex(v, sf.Index)
+	if nilPtr.IsValid() {
+		return NotFound, p.error("can't get field %s of nil %s", name, nilPtr.Type())
+	}
+	return f, nil
+}
+
+// fieldByIndex is reflect's FieldByIndex, but it returns the nil embedded
+// pointer a promoted field is behind in stead of panicking
+func fieldByIndex(v reflect.Value, index []int) (field reflect.Value, nilPtr reflect.Value) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return NotFound, v
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, NotFound
+}
+
+// index converts a step to a valid index of v (a slice, array or string)
+func (p Path) index(v reflect.Value, step PathStep) (int, error) {
+	if !step.Index {
+		return 0, p.error("can't get %s of %s", step.Name, v.Type())
+	}
+	i, err := strconv.Atoi(step.Name)
+	if err != nil {
+		return 0, p.error("can't index %s with %q", v.Type(), step.Name)
+	}
+	if i < 0 || i >= v.Len() {
+		return 0, p.error("index %d out of range (length %d)", i, v.Len())
+	}
+	return i, nil
+}
+
+// mapKey converts a step to a key of map type t
+func (p Path) mapKey(t reflect.Type, step PathStep) (reflect.Value, error) {
+	key := reflect.ValueOf(step.Name)
+	switch t.Key().Kind() {
+	case reflect.String:
+		return key.Convert(t.Key()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, err := strconv.ParseInt(step.Name, 10, 64); err == nil {
+			return reflect.ValueOf(i).Convert(t.Key()), nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, err := strconv.ParseUint(step.Name, 10, 64); err == nil {
+			return reflect.ValueOf(i).Convert(t.Key()), nil
+		}
+	}
+	return NotFound, p.error("can't index %s with %q", t, step.Name)
+}
+
+// Get resolves the path, starting at v. Missing map keys give the
+// zero value, like in Go
+func (p Path) Get(v reflect.Value) (reflect.Value, error) {
+	return p.get(v, p)
+}
+
+func (p Path) get(v reflect.Value, rest Path) (reflect.Value, error) {
+	for _, step := range rest {
+		v = indirect(v)
+		if !v.IsValid() {
+			return NotFound, p.error("can't get %s of nil", step.Name)
+		}
+
+		var err error
+		switch v.Kind() {
+		case reflect.Struct:
+			v, err = p.field(v, step.Name)
+		case reflect.Slice, reflect.Array, reflect.String:
+			var i int
+			if i, err = p.index(v, step); err == nil {
+				v = v.Index(i)
+			}
+		case reflect.Map:
+			var key reflect.Value
+			if key, err = p.mapKey(v.Type(), step); err == nil {
+				if elem := v.MapIndex(key); elem.IsValid() {
+					v = elem
+				} else {
+					v = reflect.Zero(v.Type().Elem())
+				}
+			}
+		default:
+			err = p.error("can't get %s of %s", step.Name, v.Type())
+		}
+		if err != nil {
+			return NotFound, err
+		}
+	}
+	return v, nil
+}
+
+/*
+ * Set sets the value at the path, starting at v. v should be a pointer
+ * (or addressable), otherwise only the returned copy has the change.
+ *
+ * Map elements can't be changed in place, they're copied, changed and
+ * stored again. value must be assignable to the type at the path.
+ */
+func (p Path) Set(v reflect.Value, value reflect.Value) (reflect.Value, error) {
+	return p.set(v, p, value)
+}
+
+func (p Path) set(v reflect.Value, rest Path, value reflect.Value) (reflect.Value, error) {
+	if len(rest) == 0 {
+		if !value.IsValid() {
+			return reflect.Zero(v.Type()), nil
+		}
+		if !value.Type().AssignableTo(v.Type()) {
+			return NotFound, p.error("can't use %s as %s", value.Type(), v.Type())
+		}
+		return value, nil
+	}
+	step := rest[0]
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return NotFound, p.error("can't set %s of nil", step.Name)
+		}
+		// the pointer's element is changed in place
+		elem := v.Elem()
+		updated, err := p.set(elem, rest, value)
+		if err != nil {
+			return NotFound, err
+		}
+		elem.Set(updated)
+		return v, nil
+	case reflect.Interface:
+		if v.IsNil() {
+			return NotFound, p.error("can't set %s of nil", step.Name)
+		}
+		return p.set(v.Elem(), rest, value)
+	case reflect.Struct, reflect.Array:
+		if !v.CanAddr() {
+			copied := reflect.New(v.Type()).Elem()
+			copied.Set(v)
+			v = copied
+		}
+		var elem reflect.Value
+		if v.Kind() == reflect.Struct {
+			f, err := p.field(v, step.Name)
+			if err != nil {
+				return NotFound, err
+			}
+			elem = f
+		} else {
+			i, err := p.index(v, step)
+			if err != nil {
+				return NotFound, err
+			}
+			elem = v.Index(i)
+		}
+		updated, err := p.set(elem, rest[1:], value)
+		if err != nil {
+			return NotFound, err
+		}
+		elem.Set(updated)
+		return v, nil
+	case reflect.Slice:
+		i, err := p.index(v, step)
+		if err != nil {
+			return NotFound, err
+		}
+		elem := v.Index(i)
+		updated, err := p.set(elem, rest[1:], value)
+		if err != nil {
+			return NotFound, err
+		}
+		elem.Set(updated)
+		return v, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return NotFound, p.error("can't set %s of nil map", step.Name)
+		}
+		key, err := p.mapKey(v.Type(), step)
+		if err != nil {
+			return NotFound, err
+		}
+		elem := v.MapIndex(key)
+		if !elem.IsValid() {
+			elem = reflect.Zero(v.Type().Elem())
+		}
+		updated, err := p.set(elem, rest[1:], value)
+		if err != nil {
+			return NotFound, err
+		}
+		v.SetMapIndex(key, updated)
+		return v, nil
+	}
+	return NotFound, p.error("can't set %s of %s", step.Name, v.Type())
+}
@@ -0,0 +1,169 @@
+package vtree
+
+import (
+	"reflect"
+	"testing"
+)
+
+type PathAddress struct {
+	City string
+}
+
+type PathBase struct {
+	ID int
+}
+
+type PathUser struct {
+	*PathBase
+	Name     string
+	Address  PathAddress
+	Previous *PathAddress
+	Todos    []PathTodo
+	Settings map[string]interface{}
+	Scores   map[int]int
+	secret   string
+}
+
+type PathTodo struct {
+	Title string
+}
+
+func MakePathUser() *PathUser {
+	return &PathUser{
+		PathBase: &PathBase{ID: 7},
+		Name:     "ivo",
+		Address:  PathAddress{"Utrecht"},
+		Todos:    []PathTodo{{"write"}, {"test"}},
+		Settings: map[string]interface{}{"theme": "dark", "address": PathAddress{"Delft"}},
+		Scores:   map[int]int{1: 10},
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	TestCases := map[string]Path{
+		"Name":                {{Name: "Name"}},
+		"Address.City":        {{Name: "Address"}, {Name: "City"}},
+		"Todos[1].Title":      {{Name: "Todos"}, {Name: "1", Index: true}, {Name: "Title"}},
+		`Settings["theme"]`:   {{Name: "Settings"}, {Name: "theme", Index: true}},
+		`Settings[ "a.b" ].x`: {{Name: "Settings"}, {Name: "a.b", Index: true}, {Name: "x"}},
+		"Matrix[0][1]":        {{Name: "Matrix"}, {Name: "0", Index: true}, {Name: "1", Index: true}},
+	}
+
+	for Path, Expected := range TestCases {
+		t.Run(Path, func(t *testing.T) {
+			p, err := ParsePath(Path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(p, Expected) {
+				t.Errorf("Expected %v, got %v", Expected, p)
+			}
+		})
+	}
+
+	for _, Path := range []string{"", "a..b", "a.", "a[", "a[x]", "a]", "1a", "a-b"} {
+		t.Run("Error "+Path, func(t *testing.T) {
+			if _, err := ParsePath(Path); err == nil {
+				t.Errorf("Expected an error for %q", Path)
+			}
+		})
+	}
+}
+
+func TestPathGet(t *testing.T) {
+	TestCases := map[string]interface{}{
+		"Name":                     "ivo",
+		"ID":                       7,
+		"Address.City":             "Utrecht",
+		"Todos[1].Title":           "test",
+		`Settings["theme"]`:        "dark",
+		"Settings.theme":           "dark",
+		`Settings["address"].City`: "Delft",
+		"Scores[1]":                10,
+		"Scores[2]":                0,
+	}
+
+	for Path, Expected := range TestCases {
+		t.Run(Path, func(t *testing.T) {
+			p, _ := ParsePath(Path)
+			v, err := p.Get(reflect.ValueOf(MakePathUser()))
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if v.Interface() != Expected {
+				t.Errorf("Expected %v, got %v", Expected, v.Interface())
+			}
+		})
+	}
+
+	TestErrors := map[string]string{
+		"Nope":           `vtree.PathUser has no field Nope (in path "Nope")`,
+		"Previous.City":  `can't get City of nil (in path "Previous.City")`,
+		"Todos[2].Title": `index 2 out of range (length 2) (in path "Todos[2].Title")`,
+		"Name.First":     `can't get First of string (in path "Name.First")`,
+		`Scores["a"]`:    `can't index map[int]int with "a" (in path "Scores[\"a\"]")`,
+	}
+
+	for Path, Expected := range TestErrors {
+		t.Run(Path, func(t *testing.T) {
+			p, _ := ParsePath(Path)
+			_, err := p.Get(reflect.ValueOf(MakePathUser()))
+			if err == nil || err.Error() != Expected {
+				t.Errorf("Expected error %q, got %v", Expected, err)
+			}
+		})
+	}
+}
+
+func TestPathSet(t *testing.T) {
+	TestCases := map[string]struct {
+		Value interface{}
+		Check func(u *PathUser) interface{}
+	}{
+		"Name":                     {"harm", func(u *PathUser) interface{} { return u.Name }},
+		"ID":                       {8, func(u *PathUser) interface{} { return u.ID }},
+		"Address.City":             {"Delft", func(u *PathUser) interface{} { return u.Address.City }},
+		"Todos[0].Title":           {"ship", func(u *PathUser) interface{} { return u.Todos[0].Title }},
+		`Settings["theme"]`:        {"light", func(u *PathUser) interface{} { return u.Settings["theme"] }},
+		`Settings["address"].City`: {"Leiden", func(u *PathUser) interface{} { return u.Settings["address"].(PathAddress).City }},
+		"Scores[2]":                {20, func(u *PathUser) interface{} { return u.Scores[2] }},
+		"Previous":                 {nil, func(u *PathUser) interface{} { return u.Previous == nil }},
+	}
+
+	for Path, TestCase := range TestCases {
+		t.Run(Path, func(t *testing.T) {
+			u := MakePathUser()
+			p, _ := ParsePath(Path)
+			if _, err := p.Set(reflect.ValueOf(u), reflect.ValueOf(TestCase.Value)); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			expected := TestCase.Value
+			if expected == nil {
+				expected = true
+			}
+			if r := TestCase.Check(u); r != expected {
+				t.Errorf("Expected %v, got %v", expected, r)
+			}
+		})
+	}
+
+	TestErrors := map[string]struct {
+		Value interface{}
+		Err   string
+	}{
+		"Name":          {1, `can't use int as string (in path "Name")`},
+		"Previous.City": {"x", `can't set City of nil (in path "Previous.City")`},
+		"secret":        {"x", `field secret of vtree.PathUser is unexported (in path "secret")`},
+		"Todos[5]":      {PathTodo{}, `index 5 out of range (length 2) (in path "Todos[5]")`},
+	}
+
+	for Path, TestCase := range TestErrors {
+		t.Run("Error "+Path, func(t *testing.T) {
+			p, _ := ParsePath(Path)
+			_, err := p.Set(reflect.ValueOf(MakePathUser()), reflect.ValueOf(TestCase.Value))
+			if err == nil || err.Error() != TestCase.Err {
+				t.Errorf("Expected error %q, got %v", TestCase.Err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package vtree
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// A Sequence is a collection that g-for can iterate over without it first
+// being converted into a slice. Index is called for 0 <= i < Len()
+type Sequence interface {
+	Len() int
+	Index(i int) interface{}
+}
+
+var sequenceType = reflect.TypeOf((*Sequence)(nil)).Elem()
+
+/*
+ * Iterate collects the keys and values g-for iterates over:
+ *
+ * - arrays, slices: index, element
+ * - strings: rune position, rune (as a string)
+ * - maps: key, value, ordered by key
+ * - integers: n iterates over 0 .. n-1, both key and value
+ * - Sequence: index, Index(index)
+ *
+ * Channels aren't received from here, a template may be rendered many
+ * times and receiving would consume the values. Gadget's components
+ * receive from the channels in their data, and iterate over what they
+ * received so far.
+ */
+func Iterate(value reflect.Value) (keys []reflect.Value, values []reflect.Value, err error) {
+	value = indirectInterface(value)
+	if !value.IsValid() {
+		return nil, nil, nil
+	}
+
+	if value.Type().Implements(sequenceType) && value.CanInterface() {
+		if value.Kind() == reflect.Ptr && value.IsNil() {
+			return nil, nil, nil
+		}
+		seq := value.Interface().(Sequence)
+		for i := 0; i < seq.Len(); i++ {
+			keys = append(keys, reflect.ValueOf(i))
+			values = append(values, reflect.ValueOf(seq.Index(i)))
+		}
+		return keys, values, nil
+	}
+
+	value = indirect(value)
+	switch value.Kind() {
+	case reflect.Invalid:
+		return nil, nil, nil
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < value.Len(); i++ {
+			keys = append(keys, reflect.ValueOf(i))
+			values = append(values, value.Index(i))
+		}
+	case reflect.String:
+		i := 0
+		for _, r := range value.String() {
+			keys = append(keys, reflect.ValueOf(i))
+			values = append(values, reflect.ValueOf(string(r)))
+			i++
+		}
+	case reflect.Map:
+		keys = value.MapKeys()
+		sort.Slice(keys, func(a, b int) bool {
+			return lessKey(keys[a], keys[b])
+		})
+		for _, k := range keys {
+			values = append(values, value.MapIndex(k))
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, _ := toInt(value)
+		for i := 0; i < int(n); i++ {
+			keys = append(keys, reflect.ValueOf(i))
+			values = append(values, reflect.ValueOf(i))
+		}
+	default:
+		return nil, nil, fmt.Errorf("can't iterate over %s", value.Type())
+	}
+	return keys, values, nil
+}
+
+// lessKey orders map keys: numbers and strings naturally, bools false
+// first, anything else by its printed form
+func lessKey(a, b reflect.Value) bool {
+	a, b = indirectInterface(a), indirectInterface(b)
+
+	if ai, ok := toInt(a); ok {
+		if bi, ok := toInt(b); ok {
+			return ai < bi
+		}
+	}
+	if af, ok := toFloat(a); ok {
+		if bf, ok := toFloat(b); ok {
+			return af < bf
+		}
+	}
+	if a.Kind() == reflect.String && b.Kind() == reflect.String {
+		return a.String() < b.String()
+	}
+	if a.Kind() == reflect.Bool && b.Kind() == reflect.Bool {
+		return !a.Bool() && b.Bool()
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
@@ -0,0 +1,91 @@
+package vtree
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type wordList struct {
+	words []string
+}
+
+func (w *wordList) Len() int {
+	return len(w.words)
+}
+
+func (w *wordList) Index(i int) interface{} {
+	return strings.ToUpper(w.words[i])
+}
+
+func AssertIteration(t *testing.T, value interface{}, keys string, values string) {
+	t.Helper()
+
+	k, v, err := Iterate(reflect.ValueOf(value))
+	if err != nil {
+		t.Fatalf("Unexpected error %s", err)
+	}
+	var gotKeys, gotValues []string
+	for i := range k {
+		gotKeys = append(gotKeys, Stringify(k[i]))
+		gotValues = append(gotValues, Stringify(v[i]))
+	}
+	if r := strings.Join(gotKeys, ","); r != keys {
+		t.Errorf("Expected keys %s, got %s", keys, r)
+	}
+	if r := strings.Join(gotValues, ","); r != values {
+		t.Errorf("Expected values %s, got %s", values, r)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	t.Run("Test slice", func(t *testing.T) {
+		AssertIteration(t, []string{"a", "b"}, "0,1", "a,b")
+	})
+	t.Run("Test array", func(t *testing.T) {
+		AssertIteration(t, [2]int{7, 8}, "0,1", "7,8")
+	})
+	t.Run("Test pointer to slice", func(t *testing.T) {
+		AssertIteration(t, &[]int{1}, "0", "1")
+	})
+	t.Run("Test string iterates runes", func(t *testing.T) {
+		AssertIteration(t, "héé", "0,1,2", "h,é,é")
+	})
+	t.Run("Test map ordered by string key", func(t *testing.T) {
+		AssertIteration(t, map[string]int{"c": 3, "a": 1, "b": 2}, "a,b,c", "1,2,3")
+	})
+	t.Run("Test map ordered by int key", func(t *testing.T) {
+		AssertIteration(t, map[int]string{10: "x", 2: "y", -1: "z"}, "-1,2,10", "z,y,x")
+	})
+	t.Run("Test map with interface keys", func(t *testing.T) {
+		AssertIteration(t, map[interface{}]int{"b": 1, "a": 2}, "a,b", "2,1")
+	})
+	t.Run("Test integer range", func(t *testing.T) {
+		AssertIteration(t, 3, "0,1,2", "0,1,2")
+	})
+	t.Run("Test negative integer range", func(t *testing.T) {
+		AssertIteration(t, -3, "", "")
+	})
+	t.Run("Test Sequence", func(t *testing.T) {
+		AssertIteration(t, &wordList{[]string{"go", "gadget"}}, "0,1", "GO,GADGET")
+	})
+	t.Run("Test nil Sequence", func(t *testing.T) {
+		var w *wordList
+		AssertIteration(t, w, "", "")
+	})
+	t.Run("Test nil", func(t *testing.T) {
+		AssertIteration(t, nil, "", "")
+	})
+
+	for Name, value := range map[string]interface{}{
+		"Test bool":    true,
+		"Test struct":  struct{}{},
+		"Test channel": make(chan int, 1),
+	} {
+		t.Run(Name, func(t *testing.T) {
+			if _, _, err := Iterate(reflect.ValueOf(value)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
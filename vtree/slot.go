@@ -0,0 +1,151 @@
+package vtree
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+ * Slots let a component's caller pass content into the component:
+ *
+ * <x-card>
+ *   <template g-slot="header"><h1 g-value="Title"></h1></template>
+ *   <p>Goes into the default slot</p>
+ * </x-card>
+ *
+ * The component decides where it goes with <slot> and <slot name="header">.
+ * Whatever the <slot> contains is rendered if nothing is passed for it.
+ *
+ * With a scoped slot, the component exposes values to the content, e.g. to
+ * let the caller render each row of a list:
+ *
+ * <slot name="row" :todo="todo"></slot>                  (in x-list)
+ * <template g-slot:row="props"><b g-value="props.todo.Title"></b></template>
+ *
+ * The content is rendered in the caller's context, not in the component's,
+ * so it's passed unrendered, together with the caller's context.
+ */
+
+// DefaultSlot is the name of the slot for content not in a named template
+const DefaultSlot = "default"
+
+// SlotContent is the (unrendered) content passed for a slot
+type SlotContent struct {
+	Nodes NodeList
+	// The caller's context and renderer, the content is rendered with
+	Context  *Context
+	Renderer *Renderer
+	// Scope is the variable the slot's props are assigned to, if any
+	Scope string
+	// Owner is the caller, e.g. the component that should handle events
+	// of the content. vtree doesn't use it
+	Owner interface{}
+}
+
+// Slots holds the content for a component's slots, by name
+type Slots map[string]*SlotContent
+
+// parseSlotAttribute checks if attr assigns content to a slot:
+// g-slot="name" or g-slot:name="scope"
+func parseSlotAttribute(attr string, value string) (name string, scope string, ok bool) {
+	if attr == "g-slot" {
+		return strings.TrimSpace(value), "", true
+	}
+	if strings.HasPrefix(attr, "g-slot:") {
+		return attr[len("g-slot:"):], strings.TrimSpace(value), true
+	}
+	return "", "", false
+}
+
+// CollectSlots sorts the children of a component element into slots.
+// <template g-slot..> children fill the named slot, everything else goes
+// into the default slot
+func (r *Renderer) CollectSlots(children NodeList, context *Context) Slots {
+	slots := make(Slots)
+
+	content := func(name string, scope string) *SlotContent {
+		if slots[name] == nil {
+			slots[name] = &SlotContent{Context: context.Copy(), Renderer: r}
+		}
+		if scope != "" {
+			slots[name].Scope = scope
+		}
+		return slots[name]
+	}
+
+	for _, c := range children {
+		if el, ok := c.(*Element); ok && el.Type == "template" {
+			for attr, value := range el.Attributes {
+				if name, scope, ok := parseSlotAttribute(attr, value); ok {
+					s := content(name, scope)
+					s.Nodes = append(s.Nodes, el.Children...)
+					break
+				}
+			}
+			continue
+		}
+		// Whitespace alone doesn't replace the slot's default
+		if t, ok := c.(*Text); ok && strings.TrimSpace(t.Text) == "" && slots[DefaultSlot] == nil {
+			continue
+		}
+		s := content(DefaultSlot, "")
+		s.Nodes = append(s.Nodes, c)
+	}
+	return slots
+}
+
+/*
+ * RenderSlot fills the special <slot> tag with the content passed for it,
+ * and returns true if it did. If nothing was passed, the slot's own
+ * children are rendered as usual (the default).
+ *
+ * Content may be rendered more than once (e.g. a slot in a g-for), so it
+ * gets id's derived from the slot's.
+ */
+func (r *Renderer) RenderSlot(e *Element, context *Context) bool {
+	name := DefaultSlot
+	if n, ok := e.Attributes["name"]; ok && n != "" {
+		name = n
+	}
+	content := r.Slots[name]
+	if content == nil || len(content.Nodes) == 0 {
+		return false
+	}
+
+	renderer := content.Renderer
+	if renderer == nil {
+		renderer = r
+	}
+	ctx := content.Context
+	if ctx == nil {
+		ctx = &Context{}
+	}
+	ctx = ctx.Copy()
+	if content.Scope != "" {
+		ctx.Push(content.Scope, slotProps(e))
+	}
+
+	var nodes NodeList
+	for _, n := range content.Nodes {
+		nodes = append(nodes, n.DeepClone(ElementID(fmt.Sprintf("%s-%s", e.ID, n.GetID()))))
+	}
+	e.Children = renderer.RenderChildren(nodes, ctx)
+
+	if r.SlotHandler != nil {
+		r.SlotHandler(e, content)
+	}
+	return true
+}
+
+// slotProps are the values a scoped slot exposes, e.g. :todo="todo"
+func slotProps(e *Element) map[string]interface{} {
+	props := make(map[string]interface{})
+	for attr, value := range e.BoundValues {
+		if value.IsValid() && value.CanInterface() {
+			props[attr] = value.Interface()
+		} else {
+			props[attr] = nil
+		}
+	}
+	return props
+}
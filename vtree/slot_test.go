@@ -0,0 +1,128 @@
+package vtree
+
+import (
+	"testing"
+)
+
+func TestCollectSlots(t *testing.T) {
+	children := NodeList{
+		&Text{Text: "\n  "},
+		El("template").A("g-slot", "header").C(El("h1"), El("h2")),
+		El("p"),
+		El("template").A("g-slot:row", "props").C(El("b")),
+		&Text{Text: "text"},
+	}
+	slots := NewRenderer().CollectSlots(children, &Context{})
+
+	TestCases := map[string]struct {
+		Nodes int
+		Scope string
+	}{
+		"header":  {2, ""},
+		"row":     {1, "props"},
+		"default": {2, ""},
+	}
+	if len(slots) != len(TestCases) {
+		t.Errorf("Expected %d slots, got %d", len(TestCases), len(slots))
+	}
+	for Name, TestCase := range TestCases {
+		t.Run(Name, func(t *testing.T) {
+			s, ok := slots[Name]
+			if !ok {
+				t.Fatalf("Expected slot %s", Name)
+			}
+			if len(s.Nodes) != TestCase.Nodes {
+				t.Errorf("Expected %d nodes, got %d", TestCase.Nodes, len(s.Nodes))
+			}
+			if s.Scope != TestCase.Scope {
+				t.Errorf("Expected scope %q, got %q", TestCase.Scope, s.Scope)
+			}
+		})
+	}
+
+	t.Run("Test only whitespace", func(t *testing.T) {
+		slots := NewRenderer().CollectSlots(NodeList{&Text{Text: " "}}, &Context{})
+		if _, ok := slots[DefaultSlot]; ok {
+			t.Error("Didn't expect whitespace to fill the default slot")
+		}
+	})
+}
+
+func TestRenderSlot(t *testing.T) {
+	// Renders e as the template of a component that got the
+	// children of caller
+	render := func(e *Element, caller *Element, callerCtx *Context) *Element {
+		renderer := NewRenderer()
+		renderer.Slots = renderer.CollectSlots(caller.Children, callerCtx)
+
+		ctx := &Context{}
+		ctx.Push("items", []string{"a", "b"})
+		ctx.Push("name", "component")
+		return renderer.Render(e, ctx)[0]
+	}
+	callerCtx := &Context{}
+	callerCtx.Push("name", "caller")
+
+	t.Run("Test named and default slots", func(t *testing.T) {
+		e := El("div").C(
+			El("slot").A("name", "header").T("no header"),
+			El("slot").T("no content"),
+			El("slot").A("name", "footer").T("no footer"),
+		)
+		caller := El("x-comp").C(
+			El("template").A("g-slot", "header").C(El("h1").A("g-value", "name")),
+			El("p").T("content"),
+		)
+		res := render(e, caller, callerCtx)
+
+		if r := res.ToString(); r != `<div><slot name="header"><h1>caller</h1></slot>`+
+			`<slot><p>content</p></slot><slot name="footer">no footer</slot></div>` {
+			t.Errorf("Did not get expected rendered tree, got %s", r)
+		}
+	})
+
+	t.Run("Test scoped slot", func(t *testing.T) {
+		e := El("ul").C(El("li").A("g-for", "item in items").C(
+			El("slot").A("name", "row").A(":item", "item").A(":index", "forloop.Index"),
+		))
+		caller := El("x-list").C(
+			El("template").A("g-slot:row", "row").C(
+				El("i").A("g-value", "name"),
+				El("b").A("g-value", "row.index"),
+				El("b").A("g-value", "row.item"),
+			),
+		)
+		res := render(e, caller, callerCtx)
+
+		for i, expected := range []string{"<i>caller</i><b>0</b><b>a</b>", "<i>caller</i><b>1</b><b>b</b>"} {
+			slot := res.Children[i].(*Element).Children[0].(*Element)
+			r := ""
+			for _, c := range slot.Children {
+				r += c.ToString()
+			}
+			if r != expected {
+				t.Errorf("Expected row %d to render %s, got %s", i, expected, r)
+			}
+		}
+
+		first := res.Children[0].(*Element).Children[0].(*Element).Children[0]
+		second := res.Children[1].(*Element).Children[0].(*Element).Children[0]
+		if first.GetID() == second.GetID() {
+			t.Errorf("Expected slot content to get distinct ids, got %s twice", first.GetID())
+		}
+	})
+
+	t.Run("Test slot handler", func(t *testing.T) {
+		var filled []*Element
+		renderer := NewRenderer()
+		renderer.Slots = Slots{DefaultSlot: &SlotContent{Nodes: NodeList{El("p")}, Context: &Context{}}}
+		renderer.SlotHandler = func(slot *Element, content *SlotContent) {
+			filled = append(filled, slot)
+		}
+		renderer.Render(El("div").C(El("slot"), El("slot").A("name", "other")), &Context{})
+
+		if len(filled) != 1 {
+			t.Errorf("Expected the handler to be called once, got %d", len(filled))
+		}
+	})
+}
@@ -2,8 +2,10 @@ package vtree
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 /*
@@ -34,11 +36,34 @@ import (
 // ElementID uniquely enumerates ID's
 type ElementID string
 
-var _id int
+// An IDSource hands out element ids. A Gadget has its own, so the ids of its
+// elements don't depend on what else runs in the process: a server and a
+// client rendering the same app hand out the same ids
+type IDSource struct {
+	Prefix string
+	last   int64
+}
+
+// globalIDs is where El gets its ids
+var globalIDs IDSource
+
+// Next returns a new id. It's safe for concurrent use. A nil IDSource
+// hands out El's ids
+func (s *IDSource) Next() ElementID {
+	if s == nil {
+		s = &globalIDs
+	}
+	return ElementID(s.Prefix + strconv.FormatInt(atomic.AddInt64(&s.last, 1), 10))
+}
 
-func nextID() ElementID {
-	_id++
-	return ElementID(strconv.Itoa(_id))
+// El constructs an element with an id from s
+func (s *IDSource) El(Type string) *Element {
+	return &Element{ID: s.Next(), Type: Type, Attributes: make(Attributes), Handlers: make(map[string]callable)}
+}
+
+// Fragment constructs a fragment with an id from s
+func (s *IDSource) Fragment(children ...Node) *Element {
+	return s.El(FragmentType).C(children...)
 }
 
 type Attributes map[string]string
@@ -62,7 +87,8 @@ type Node interface {
 	DeepClone(ElementID) Node
 }
 
-type callable func()
+// callable is a handler bound to an event on an element, e.g. a click
+type callable func(*Event)
 
 // An Element node is a regular old html element, e.g. <div>
 type Element struct {
@@ -70,14 +96,38 @@ type Element struct {
 	Type       string
 	Attributes Attributes
 	Children   NodeList
-	Handlers   map[string]callable
-	Setter     func(string)
+	Handlers   map[string]callable // event attribute -> handler
+	// BoundValues holds the values of g-bind:attr, before they're
+	// converted into (string) attributes
+	BoundValues map[string]reflect.Value
 }
 
+// IsComponent tells if the element mounts a component: a custom element
+// like <my-component>, or a dynamic <component :is="...">
 func (e *Element) IsComponent() bool {
+	if e.Type == "component" {
+		return true
+	}
 	return strings.Contains(e.Type, "-") && !strings.HasPrefix(e.Type, "g-")
 }
 
+/*
+ * A fragment holds the root nodes of a template that doesn't have exactly
+ * one root element, e.g. several elements, or a root with g-if or g-for
+ * which may render to none or many. It doesn't exist on the other side of
+ * the bridge: its children are added to the fragment's parent directly.
+ */
+const FragmentType = "g-fragment"
+
+// Fragment constructs a fragment holding children
+func Fragment(children ...Node) *Element {
+	return globalIDs.Fragment(children...)
+}
+
+func (e *Element) IsFragment() bool {
+	return e.Type == FragmentType
+}
+
 // A Text node contains the text within an Element node. It doesn't have much special properties
 type Text struct {
 	ID   ElementID
@@ -115,11 +165,39 @@ func (t *Text) Equals(other Node) bool {
 	return t.GetID() == tt.GetID()
 }
 
+// A Comment node is an HTML comment. It's only in the tree if the template
+// was parsed with ParseOptions.Comments
+type Comment struct {
+	ID   ElementID
+	Text string
+}
+
+func (c *Comment) GetID() ElementID {
+	return c.ID
+}
+
+func (c *Comment) ToString() string {
+	return "<!--" + c.Text + "-->"
+}
+
+func (c *Comment) Clone() Node {
+	return &Comment{c.ID, c.Text}
+}
+
+func (c *Comment) DeepClone(newID ElementID) Node {
+	return &Comment{newID, c.Text}
+}
+
+func (c *Comment) Equals(other Node) bool {
+	cc, ok := other.(*Comment)
+	return ok && c.ID == cc.ID && c.Text == cc.Text
+}
+
 type NodeList []Node
 
 // El constructs an element of a specific type
 func El(Type string) *Element {
-	return &Element{ID: nextID(), Type: Type, Attributes: make(Attributes), Handlers: make(map[string]callable)}
+	return globalIDs.El(Type)
 }
 
 func (el *Element) Clone() Node {
@@ -133,12 +211,28 @@ func (el *Element) Clone() Node {
 		attrClone[atName] = atVal
 	}
 
+	// Handlers get bound to the rendered clone, so they can't be shared
+	handlersClone := make(map[string]callable)
+
+	for event, handler := range el.Handlers {
+		handlersClone[event] = handler
+	}
+
+	var boundClone map[string]reflect.Value
+	if el.BoundValues != nil {
+		boundClone = make(map[string]reflect.Value)
+		for attr, value := range el.BoundValues {
+			boundClone[attr] = value
+		}
+	}
+
 	// XXX test/assert attributes are copied
 	return &Element{ID: el.ID,
-		Type:       el.Type,
-		Attributes: attrClone,
-		Handlers:   el.Handlers,
-		Children:   el.Children}
+		Type:        el.Type,
+		Attributes:  attrClone,
+		Handlers:    handlersClone,
+		BoundValues: boundClone,
+		Children:    el.Children}
 }
 
 func (el *Element) DeepClone(newID ElementID) Node {
@@ -41,3 +41,17 @@ func TestIsComponentElement(t *testing.T) {
 		t.Error("Expected IsComponent not to be true on 'div'")
 	}
 }
+
+func TestCloneHandlers(t *testing.T) {
+	el := El("button")
+	el.Handlers["g-click"] = func(*Event) {}
+	clone := el.Clone().(*Element)
+	clone.Handlers["g-on:mouseover"] = func(*Event) {}
+
+	if len(clone.Handlers) != 2 {
+		t.Errorf("Expected handlers to be copied, got %d", len(clone.Handlers))
+	}
+	if len(el.Handlers) != 1 {
+		t.Errorf("Expected original handlers to be unaffected, got %d", len(el.Handlers))
+	}
+}
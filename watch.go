@@ -0,0 +1,184 @@
+package gadget
+
+import (
+	"reflect"
+)
+
+/*
+ * Watchers react to changes of a component's data that don't come from an
+ * event, e.g. fetching again when a prop changes:
+ *
+ * func (c *UserComponent) Created() {
+ *     c.State.Watch("ID", func(old, new interface{}) {
+ *         c.fetch(new.(int))
+ *     })
+ * }
+ *
+ * Watch fires when the value is replaced, WatchDeep also when something
+ * inside it changes, like an element of a slice or a field of a struct it
+ * points to. A deep watcher keeps a copy of the value for old, the copy
+ * follows pointers, slices and maps like the fingerprints do, but doesn't
+ * copy unexported fields.
+ *
+ * Watchers are checked when their component is built, once its props are
+ * set, and only if its storage reports their key as changed (see
+ * TrackingStorage). A deep watcher on a key fires whenever it's reported,
+ * e.g. also when it's written with an equal value. A storage that doesn't
+ * track changes has all its watchers checked every time.
+ *
+ * Watchers run as Actions in the next pass of the loop, so a loop that
+ * queues watchers renders the stale state first and renders again after
+ * they ran, until no more watchers are queued or maxPasses is reached.
+ */
+
+type watcher struct {
+	key  string
+	deep bool
+	fn   func(old, new interface{})
+	// tracked is set if the tracker tells when key changed, only a path
+	// in it (e.g. Todos[0]) needs a fingerprint then
+	tracked     bool
+	value       interface{}
+	fingerprint uint64
+}
+
+// needsFingerprint tells if a deep watcher fingerprints its value itself
+func (w *watcher) needsFingerprint() bool {
+	return w.deep && (!w.tracked || firstKey(w.key) != w.key)
+}
+
+// changed tells if value differs from what the watcher saw last, its key
+// was reported as changed if it's tracked
+func (w *watcher) changed(value interface{}) bool {
+	if w.needsFingerprint() {
+		return fingerprint(reflect.ValueOf(value)) != w.fingerprint
+	}
+	if w.deep {
+		return true
+	}
+	// a slice or pointer that wasn't replaced is still equal
+	return !reflect.DeepEqual(w.value, value)
+}
+
+func (w *watcher) update(value interface{}) {
+	w.value = value
+	if w.deep {
+		v := reflect.ValueOf(value)
+		if w.needsFingerprint() {
+			w.fingerprint = fingerprint(v)
+		}
+		if v.IsValid() {
+			w.value = deepCopy(v, make(map[uintptr]reflect.Value)).Interface()
+		}
+	}
+}
+
+// deepCopy copies v, and what it points to. copies maps the pointers that
+// were copied to their copy, so shared and cyclic data stay that way
+func deepCopy(v reflect.Value, copies map[uintptr]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := copies[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		copies[v.Pointer()] = c
+		c.Elem().Set(deepCopy(v.Elem(), copies))
+		return c
+	case reflect.Interface:
+		c := reflect.New(v.Type()).Elem()
+		if !v.IsNil() {
+			c.Set(deepCopy(v.Elem(), copies))
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copies))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopy(v.Index(i), copies))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		if c, ok := copies[v.Pointer()]; ok {
+			return c
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		copies[v.Pointer()] = c
+		for _, key := range v.MapKeys() {
+			c.SetMapIndex(key, deepCopy(v.MapIndex(key), copies))
+		}
+		return c
+	case reflect.Struct:
+		// a plain copy, then the fields that can be set are copied deeply
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if c.Field(i).CanSet() {
+				c.Field(i).Set(deepCopy(v.Field(i), copies))
+			}
+		}
+		return c
+	}
+	return v
+}
+
+// WatchAction runs a watcher
+type WatchAction struct {
+	fn       func(old, new interface{})
+	old, new interface{}
+}
+
+func (a *WatchAction) Run() {
+	a.fn(a.old, a.new)
+}
+
+// Watch calls fn when the value of key is replaced
+func (s *ComponentState) Watch(key string, fn func(old, new interface{})) {
+	s.watch(key, false, fn)
+}
+
+// WatchDeep calls fn when anything in the value of key changes
+func (s *ComponentState) WatchDeep(key string, fn func(old, new interface{})) {
+	s.watch(key, true, fn)
+}
+
+func (s *ComponentState) watch(key string, deep bool, fn func(old, new interface{})) {
+	_, tracked := s.instance.Comp.Data().(TrackingStorage)
+	w := &watcher{key: key, deep: deep, fn: fn, tracked: tracked}
+	w.update(s.instance.Comp.Data().RawGetValue(key))
+	s.watchers = append(s.watchers, w)
+}
+
+// queueWatchers queues the watchers whose key changed. It uses the changes
+// found by changed, so it must be called after it
+func (ci *ComponentInstance) queueWatchers(g *Gadget) {
+	changed := make(map[string]bool)
+	for _, key := range ci.State.changes {
+		changed[key] = true
+	}
+	data := ci.Comp.Data()
+	for _, w := range ci.State.watchers {
+		if w.tracked && !changed[firstKey(w.key)] {
+			continue
+		}
+		value := data.RawGetValue(w.key)
+		if w.changed(value) {
+			g.enqueue(&WatchAction{fn: w.fn, old: w.value, new: value})
+			w.update(value)
+		}
+	}
+}
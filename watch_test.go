@@ -0,0 +1,155 @@
+package gadget
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+type WatchComponent struct {
+	GeneratedComponent
+	ID    int
+	Title string
+	Todos []Todo
+	Log   []string
+}
+
+func (w *WatchComponent) Created() {
+	log := func(key string) func(old, new interface{}) {
+		return func(old, new interface{}) {
+			w.Log = append(w.Log, fmt.Sprintf("%s:%v->%v", key, old, new))
+		}
+	}
+	w.State.Watch("ID", log("ID"))
+	w.State.Watch("Todos", log("Todos"))
+	w.State.WatchDeep("Todos", func(old, new interface{}) {
+		w.Log = append(w.Log, fmt.Sprintf("deep:%v->%v", old, new))
+		// watchers run before rendering, what they change is rendered too
+		w.Title = "saved"
+	})
+}
+
+// CountingStorage counts the values that are read through RawGetValue
+type CountingStorage struct {
+	*StructStorage
+	Gets map[string]int
+}
+
+func (c *CountingStorage) RawGetValue(key string) interface{} {
+	c.Gets[key]++
+	return c.StructStorage.RawGetValue(key)
+}
+
+func TestWatch(t *testing.T) {
+	SetupTestGadget := func() (*Gadget, *WatchComponent) {
+		g := NewGadget(NewTestBridge())
+		var watched *WatchComponent
+		child := &ComponentFactory{
+			Name: "x-watched",
+			Builder: func() Component {
+				watched = &WatchComponent{Todos: []Todo{{1, "write", false}}}
+				watched.gTemplate = `<b g-value="Title"></b>`
+				watched.gProps = []string{"ID"}
+				watched.SetupStorage(NewStructStorage(watched))
+				return watched
+			},
+		}
+		component := g.NewComponent(MakeDummyFactory(`<div><x-watched :ID="IntArrayVal[0]"></x-watched></div>`,
+			map[string]*ComponentFactory{"x-watched": child}, nil))
+		component.SetValue("IntArrayVal", []int{1})
+		g.Mount(component)
+		g.SingleLoop()
+		return g, watched
+	}
+
+	t.Run("Test nothing changed", func(t *testing.T) {
+		g, w := SetupTestGadget()
+		g.SingleLoop()
+
+		if r := strings.Join(w.Log, ","); r != "" {
+			t.Errorf("Expected no watchers to run, got %s", r)
+		}
+	})
+
+	t.Run("Test prop changed", func(t *testing.T) {
+		g, w := SetupTestGadget()
+		g.App.SetValue("IntArrayVal", []int{2})
+		g.SingleLoop()
+
+		if r := strings.Join(w.Log, ","); r != "ID:1->2" {
+			t.Errorf("Expected the prop's watcher to run, got %s", r)
+		}
+	})
+
+	t.Run("Test deep", func(t *testing.T) {
+		g, w := SetupTestGadget()
+		w.Todos[0].Done = true
+		g.SingleLoop()
+
+		if r := strings.Join(w.Log, ","); r != "deep:[{1 write false}]->[{1 write true}]" {
+			t.Errorf("Expected only the deep watcher to run, got %s", r)
+		}
+		if r := g.App.State.Mounts[0].Component.State.ExecutedTree.ToString(); r != "<b>saved</b>" {
+			t.Errorf("Expected the watcher's change to be rendered, got %s", r)
+		}
+	})
+
+	t.Run("Test replaced", func(t *testing.T) {
+		g, w := SetupTestGadget()
+		w.Todos = append(w.Todos, Todo{2, "test", false})
+		g.SingleLoop()
+
+		if r := strings.Join(w.Log, ","); r != "Todos:[{1 write false}]->[{1 write false} {2 test false}],deep:[{1 write false}]->[{1 write false} {2 test false}]" {
+			t.Errorf("Expected both watchers to run, got %s", r)
+		}
+	})
+
+	t.Run("Test only changed keys", func(t *testing.T) {
+		g, w := SetupTestGadget()
+		storage := &CountingStorage{StructStorage: w.Storage.(*StructStorage), Gets: make(map[string]int)}
+		w.SetupStorage(storage)
+
+		w.Title = "changed"
+		g.SingleLoop()
+		if storage.Gets["Todos"] != 0 {
+			t.Errorf("Didn't expect Todos to be read, got %d reads", storage.Gets["Todos"])
+		}
+
+		w.Todos[0].Done = true
+		g.SingleLoop()
+		if storage.Gets["Todos"] != 2 {
+			t.Errorf("Expected Todos to be read by both its watchers, got %d reads", storage.Gets["Todos"])
+		}
+	})
+
+	t.Run("Test queued concurrently", func(t *testing.T) {
+		g, w := SetupTestGadget()
+		// what MainLoop does with actions sent on Update
+		stop := make(chan bool)
+		done := make(chan bool)
+		go func() {
+			defer close(done)
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				g.enqueue(&WatchAction{fn: func(old, new interface{}) {}})
+			}
+		}()
+		loops := 0
+		for start := time.Now(); time.Since(start) < 100*time.Millisecond; loops++ {
+			w.Todos[0].ID = loops + 2
+			g.SingleLoop()
+		}
+		close(stop)
+		<-done
+		g.SingleLoop()
+
+		if len(w.Log) != loops || g.queued() != 0 {
+			t.Errorf("Expected the watcher to run every loop and the queue to be empty, got %d of %d, %d", len(w.Log), loops, g.queued())
+		}
+	})
+}